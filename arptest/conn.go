@@ -0,0 +1,243 @@
+// Package arptest provides utilities for testing code which sends and
+// receives ARP packets, without requiring elevated privileges or a real
+// network interface.
+package arptest
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/caser789/raw"
+)
+
+var (
+	// ErrInvalidAddr is returned by PipeConn.WriteTo when the destination
+	// address is not a *raw.Addr
+	ErrInvalidAddr = errors.New("address must be a *raw.Addr")
+)
+
+// pipeQueueLen is the number of frames which may be written to a PipeConn
+// before writes block waiting for its peer to read
+const pipeQueueLen = 64
+
+var _ net.PacketConn = &PipeConn{}
+
+// A PipeConn is one end of an in-memory, full duplex link created by Pipe.
+// Frames written by one end are read by the other, regardless of their
+// destination address, as if the ends were connected by a cable.
+//
+// PipeConn implements net.PacketConn, including read and write deadlines,
+// and can be passed anywhere a raw socket is expected, such as arp.New.
+type PipeConn struct {
+	addr *raw.Addr
+	peer *PipeConn
+
+	frames chan pipeFrame
+
+	rdeadline pipeDeadline
+	wdeadline pipeDeadline
+
+	once sync.Once
+	done chan struct{}
+}
+
+// A pipeFrame is a frame in transit between two ends of a pipe
+type pipeFrame struct {
+	b    []byte
+	from *raw.Addr
+}
+
+// Pipe creates an in-memory link, and returns a PipeConn for each end. The
+// hardware addresses a and b are reported as the local addresses of each
+// end, and as the source address of frames read by the opposite end.
+func Pipe(a, b net.HardwareAddr) (*PipeConn, *PipeConn) {
+	ca := newPipeConn(a)
+	cb := newPipeConn(b)
+
+	ca.peer = cb
+	cb.peer = ca
+
+	return ca, cb
+}
+
+// newPipeConn creates a PipeConn with the specified local address
+func newPipeConn(addr net.HardwareAddr) *PipeConn {
+	return &PipeConn{
+		addr:      &raw.Addr{HardwareAddr: addr},
+		frames:    make(chan pipeFrame, pipeQueueLen),
+		rdeadline: makePipeDeadline(),
+		wdeadline: makePipeDeadline(),
+		done:      make(chan struct{}),
+	}
+}
+
+// ReadFrom reads a single frame written by the PipeConn's peer into b. The
+// returned address is a *raw.Addr containing the peer's hardware address.
+// If b is too small to contain the frame, the frame is truncated.
+func (p *PipeConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	select {
+	case <-p.done:
+		return 0, nil, io.ErrClosedPipe
+	case <-p.rdeadline.wait():
+		return 0, nil, &timeoutError{}
+	default:
+	}
+
+	select {
+	case f := <-p.frames:
+		return copy(b, f.b), f.from, nil
+	case <-p.done:
+		return 0, nil, io.ErrClosedPipe
+	case <-p.rdeadline.wait():
+		return 0, nil, &timeoutError{}
+	}
+}
+
+// WriteTo writes a single frame to the PipeConn's peer. addr must be a
+// *raw.Addr, but is otherwise ignored. If the peer has too many unread
+// frames, WriteTo blocks until the peer reads one, or the write deadline
+// expires.
+func (p *PipeConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if _, ok := addr.(*raw.Addr); !ok {
+		return 0, ErrInvalidAddr
+	}
+
+	select {
+	case <-p.done:
+		return 0, io.ErrClosedPipe
+	case <-p.peer.done:
+		return 0, io.ErrClosedPipe
+	case <-p.wdeadline.wait():
+		return 0, &timeoutError{}
+	default:
+	}
+
+	f := pipeFrame{
+		b:    append([]byte(nil), b...),
+		from: p.addr,
+	}
+
+	select {
+	case p.peer.frames <- f:
+		return len(b), nil
+	case <-p.done:
+		return 0, io.ErrClosedPipe
+	case <-p.peer.done:
+		return 0, io.ErrClosedPipe
+	case <-p.wdeadline.wait():
+		return 0, &timeoutError{}
+	}
+}
+
+// Close closes the PipeConn. Blocked reads and writes are unblocked and
+// return io.ErrClosedPipe, as do writes by its peer. Close may be called
+// more than once.
+func (p *PipeConn) Close() error {
+	p.once.Do(func() {
+		close(p.done)
+	})
+
+	return nil
+}
+
+// LocalAddr returns the PipeConn's hardware address as a *raw.Addr.
+func (p *PipeConn) LocalAddr() net.Addr {
+	return p.addr
+}
+
+// SetDeadline sets the read and write deadlines of the PipeConn.
+func (p *PipeConn) SetDeadline(t time.Time) error {
+	p.rdeadline.set(t)
+	p.wdeadline.set(t)
+	return nil
+}
+
+// SetReadDeadline sets the read deadline of the PipeConn.
+func (p *PipeConn) SetReadDeadline(t time.Time) error {
+	p.rdeadline.set(t)
+	return nil
+}
+
+// SetWriteDeadline sets the write deadline of the PipeConn.
+func (p *PipeConn) SetWriteDeadline(t time.Time) error {
+	p.wdeadline.set(t)
+	return nil
+}
+
+// pipeDeadline is a deadline which can be waited on using a channel, which
+// is closed once the deadline expires
+type pipeDeadline struct {
+	mu     sync.Mutex
+	timer  *time.Timer
+	cancel chan struct{}
+}
+
+func makePipeDeadline() pipeDeadline {
+	return pipeDeadline{cancel: make(chan struct{})}
+}
+
+// set sets the deadline to t. A zero value for t clears the deadline.
+func (d *pipeDeadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Wait for a running timer to finish closing the channel before it is
+	// replaced
+	if d.timer != nil && !d.timer.Stop() {
+		<-d.cancel
+	}
+	d.timer = nil
+
+	closed := isClosedChan(d.cancel)
+	if t.IsZero() {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		return
+	}
+
+	if dur := time.Until(t); dur > 0 {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+
+		cancel := d.cancel
+		d.timer = time.AfterFunc(dur, func() {
+			close(cancel)
+		})
+		return
+	}
+
+	// The deadline is in the past
+	if !closed {
+		close(d.cancel)
+	}
+}
+
+// wait returns a channel which is closed when the deadline expires
+func (d *pipeDeadline) wait() chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.cancel
+}
+
+// isClosedChan reports whether c is closed
+func isClosedChan(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
+// timeoutError is a net.Error returned when a deadline expires
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
@@ -0,0 +1,100 @@
+package arptest
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/caser789/raw"
+)
+
+var (
+	macA = net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+	macB = net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+)
+
+func TestPipeReadWrite(t *testing.T) {
+	a, b := Pipe(macA, macB)
+	defer a.Close()
+	defer b.Close()
+
+	frame := []byte{0xde, 0xad, 0xbe, 0xef}
+	if _, err := a.WriteTo(frame, &raw.Addr{HardwareAddr: macB}); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 128)
+	n, addr, err := b.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := frame, buf[:n]; !bytes.Equal(want, got) {
+		t.Fatalf("unexpected frame: %v != %v", want, got)
+	}
+	if want, got := macA.String(), addr.(*raw.Addr).HardwareAddr.String(); want != got {
+		t.Fatalf("unexpected source address: %v != %v", want, got)
+	}
+	if want, got := macB.String(), b.LocalAddr().String(); want != got {
+		t.Fatalf("unexpected local address: %v != %v", want, got)
+	}
+}
+
+func TestPipeWriteToInvalidAddr(t *testing.T) {
+	a, _ := Pipe(macA, macB)
+
+	if _, err := a.WriteTo(nil, &net.UDPAddr{}); err != ErrInvalidAddr {
+		t.Fatalf("unexpected error: %v != %v", ErrInvalidAddr, err)
+	}
+}
+
+func TestPipeReadDeadline(t *testing.T) {
+	a, _ := Pipe(macA, macB)
+
+	if err := a.SetReadDeadline(time.Now().Add(10 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err := a.ReadFrom(make([]byte, 128))
+	if nerr, ok := err.(net.Error); !ok || !nerr.Timeout() {
+		t.Fatalf("expected timeout error, got: %v", err)
+	}
+
+	// Clearing the deadline allows reads to succeed again
+	if err := a.SetReadDeadline(time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-a.rdeadline.wait():
+		t.Fatal("read deadline still expired after being cleared")
+	default:
+	}
+}
+
+func TestPipeClose(t *testing.T) {
+	a, b := Pipe(macA, macB)
+
+	errC := make(chan error, 1)
+	go func() {
+		_, _, err := a.ReadFrom(make([]byte, 128))
+		errC <- err
+	}()
+
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Close(); err != nil {
+		t.Fatalf("unexpected error closing twice: %v", err)
+	}
+
+	if want, got := io.ErrClosedPipe, <-errC; want != got {
+		t.Fatalf("unexpected read error: %v != %v", want, got)
+	}
+
+	if _, err := b.WriteTo([]byte{0}, &raw.Addr{}); err != io.ErrClosedPipe {
+		t.Fatalf("unexpected write error to closed peer: %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package arp
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/caser789/ethernet"
+)
+
+// readUntil reads ARP packets from c and passes each to handle, until ctx
+// is canceled, handle returns an error, or reading fails. Malformed packets
+// sent by peers are skipped. If ctx is canceled, readUntil returns nil.
+//
+// readUntil holds c's read lock only while reading each packet, so it
+// competes fairly with other readers. On cancelation, a read in progress by
+// readUntil is unblocked by setting a read deadline, and the read deadline
+// most recently set by the caller is restored before the read lock is
+// released. Reads by other readers are never interrupted.
+func readUntil(ctx context.Context, c *Client, handle func(p *Packet, f *ethernet.Frame) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+
+	// mu guards reading, which is set while readUntil holds the read lock,
+	// and interrupted, which is set once its read has been unblocked
+	var (
+		mu          sync.Mutex
+		reading     bool
+		interrupted bool
+	)
+
+	unblocked := make(chan struct{})
+	go func() {
+		defer close(unblocked)
+		<-ctx.Done()
+
+		mu.Lock()
+		defer mu.Unlock()
+		if reading {
+			interrupted = true
+			_ = c.p.SetReadDeadline(time.Now())
+		}
+	}()
+
+	defer func() {
+		cancel()
+		<-unblocked
+	}()
+
+	read := func() (*Packet, *ethernet.Frame, error) {
+		c.rmu.Lock()
+		defer c.rmu.Unlock()
+
+		mu.Lock()
+		if ctx.Err() != nil {
+			mu.Unlock()
+			return nil, nil, ctx.Err()
+		}
+		reading = true
+		mu.Unlock()
+
+		p, f, err := c.read(false)
+
+		mu.Lock()
+		reading = false
+		if interrupted {
+			_ = c.restoreReadDeadline()
+		}
+		mu.Unlock()
+
+		return p, f, err
+	}
+
+	for {
+		p, f, err := read()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			// Skip malformed packets sent by peers
+			if _, ok := err.(*DecodeError); ok {
+				continue
+			}
+
+			return err
+		}
+
+		if err := handle(p, f); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return err
+		}
+	}
+}
+
+// A background runs a single function in a goroutine between calls to
+// start and stop, for types which read from a Client in the background.
+type background struct {
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// err is the error returned by fn, and is only valid once done is
+	// closed
+	err error
+}
+
+// start runs fn in a new goroutine with a context which is canceled when
+// stop is called
+func (b *background) start(ctx context.Context, fn func(ctx context.Context) error) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	b.mu.Lock()
+	b.cancel = cancel
+	b.done = done
+	b.mu.Unlock()
+
+	go func() {
+		defer close(done)
+		b.err = fn(ctx)
+		cancel()
+	}()
+}
+
+// stop cancels the function run by start, waits for it to return, and
+// returns its error. stop may be called more than once. If start was never
+// called, stop returns nil.
+func (b *background) stop() error {
+	b.mu.Lock()
+	cancel, done := b.cancel, b.done
+	b.mu.Unlock()
+
+	if cancel == nil {
+		return nil
+	}
+
+	cancel()
+	<-done
+	return b.err
+}
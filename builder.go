@@ -0,0 +1,97 @@
+package arp
+
+import (
+	"net"
+
+	"github.com/caser789/ethernet"
+)
+
+// A PacketBuilder builds a Packet using chainable methods, allowing fields
+// which NewPacket sets to defaults, such as HardwareType, to be customized.
+//
+// The zero value of PacketBuilder is not ready for use; use
+// NewPacketBuilder to create one.
+type PacketBuilder struct {
+	op Operation
+
+	srcMAC net.HardwareAddr
+	srcIP  net.IP
+	dstMAC net.HardwareAddr
+	dstIP  net.IP
+
+	htype uint16
+	ptype uint16
+
+	// inferHType indicates that htype should be inferred from the length
+	// of the sender hardware address
+	inferHType bool
+}
+
+// NewPacketBuilder creates a new PacketBuilder. Unless overridden,
+// packets are built using the same hardware and protocol types as
+// NewPacket.
+func NewPacketBuilder() *PacketBuilder {
+	return &PacketBuilder{
+		htype: 1,
+		ptype: uint16(ethernet.EtherTypeIPv4),
+	}
+}
+
+// Operation sets the ARP operation of the Packet.
+func (b *PacketBuilder) Operation(op Operation) *PacketBuilder {
+	b.op = op
+	return b
+}
+
+// Sender sets the sender hardware and IPv4 addresses of the Packet.
+func (b *PacketBuilder) Sender(mac net.HardwareAddr, ip net.IP) *PacketBuilder {
+	b.srcMAC = mac
+	b.srcIP = ip
+	return b
+}
+
+// Target sets the target hardware and IPv4 addresses of the Packet.
+func (b *PacketBuilder) Target(mac net.HardwareAddr, ip net.IP) *PacketBuilder {
+	b.dstMAC = mac
+	b.dstIP = ip
+	return b
+}
+
+// HardwareType sets the IANA-assigned hardware type of the Packet.
+func (b *PacketBuilder) HardwareType(htype uint16) *PacketBuilder {
+	b.htype = htype
+	b.inferHType = false
+	return b
+}
+
+// InferHardwareType sets the hardware type of the Packet using
+// InferHardwareType with the length of the sender hardware address, when
+// the Packet is built.
+func (b *PacketBuilder) InferHardwareType() *PacketBuilder {
+	b.inferHType = true
+	return b
+}
+
+// ProtocolType sets the internetwork protocol type of the Packet.
+func (b *PacketBuilder) ProtocolType(ptype uint16) *PacketBuilder {
+	b.ptype = ptype
+	return b
+}
+
+// Build creates a Packet from the values set on the PacketBuilder. The
+// addresses are validated in the same way as NewPacket, and the same
+// errors are returned.
+func (b *PacketBuilder) Build() (*Packet, error) {
+	p, err := NewPacket(b.op, b.srcMAC, b.srcIP, b.dstMAC, b.dstIP)
+	if err != nil {
+		return nil, err
+	}
+
+	p.HardwareType = b.htype
+	if b.inferHType {
+		p.HardwareType = uint16(InferHardwareType(len(b.srcMAC)))
+	}
+	p.ProtocolType = b.ptype
+
+	return p, nil
+}
@@ -0,0 +1,116 @@
+package arp
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/caser789/ethernet"
+)
+
+func TestPacketBuilderBuild(t *testing.T) {
+	zeroMAC := net.HardwareAddr{0, 0, 0, 0, 0, 0}
+	ip1 := net.IP{192, 168, 1, 10}
+	ip2 := net.IP{192, 168, 1, 1}
+
+	iboip1 := net.HardwareAddr(bytes.Repeat([]byte{0}, 20))
+	iboip2 := net.HardwareAddr(bytes.Repeat([]byte{1}, 20))
+
+	var tests = []struct {
+		desc string
+		b    *PacketBuilder
+		p    *Packet
+		err  error
+	}{
+		{
+			desc: "short sender MAC address",
+			b: NewPacketBuilder().
+				Operation(OperationRequest).
+				Sender(net.HardwareAddr{0, 0, 0, 0, 0}, ip1).
+				Target(zeroMAC, ip2),
+			err: ErrInvalidMAC,
+		},
+		{
+			desc: "IPv6 target IP address",
+			b: NewPacketBuilder().
+				Operation(OperationRequest).
+				Sender(zeroMAC, ip1).
+				Target(zeroMAC, net.IPv6loopback),
+			err: ErrInvalidIP,
+		},
+		{
+			desc: "defaults match NewPacket",
+			b: NewPacketBuilder().
+				Operation(OperationRequest).
+				Sender(zeroMAC, ip1).
+				Target(ethernet.Broadcast, ip2),
+			p: &Packet{
+				HardwareType: 1,
+				ProtocolType: uint16(ethernet.EtherTypeIPv4),
+				MACLength:    6,
+				IPLength:     4,
+				Operation:    OperationRequest,
+				SenderMAC:    zeroMAC,
+				SenderIP:     ip1,
+				TargetMAC:    ethernet.Broadcast,
+				TargetIP:     ip2,
+			},
+		},
+		{
+			desc: "ARP reply over infiniband, 20 byte MAC addresses",
+			b: NewPacketBuilder().
+				Operation(OperationReply).
+				Sender(iboip1, ip1).
+				Target(iboip2, ip2).
+				HardwareType(32),
+			p: &Packet{
+				HardwareType: 32,
+				ProtocolType: uint16(ethernet.EtherTypeIPv4),
+				MACLength:    20,
+				IPLength:     4,
+				Operation:    OperationReply,
+				SenderMAC:    iboip1,
+				SenderIP:     ip1,
+				TargetMAC:    iboip2,
+				TargetIP:     ip2,
+			},
+		},
+		{
+			desc: "infiniband hardware type inferred from MAC length",
+			b: NewPacketBuilder().
+				Operation(OperationReply).
+				Sender(iboip1, ip1).
+				Target(iboip2, ip2).
+				InferHardwareType(),
+			p: &Packet{
+				HardwareType: 32,
+				ProtocolType: uint16(ethernet.EtherTypeIPv4),
+				MACLength:    20,
+				IPLength:     4,
+				Operation:    OperationReply,
+				SenderMAC:    iboip1,
+				SenderIP:     ip1,
+				TargetMAC:    iboip2,
+				TargetIP:     ip2,
+			},
+		},
+	}
+
+	for i, tt := range tests {
+		p, err := tt.b.Build()
+		if err != nil {
+			if want, got := tt.err, err; want != got {
+				t.Fatalf("[%02d] test %q, unexpected error: %v != %v",
+					i, tt.desc, want, got)
+			}
+
+			continue
+		}
+
+		if want, got := tt.p, p; !reflect.DeepEqual(want, got) {
+			t.Fatalf("[%02d] test %q, unexpected Packet:\n- want: %v\n- got: %v",
+				i, tt.desc, want, got)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package arp
+
+import (
+	"net"
+)
+
+//go:generate stringer -output=kind_string.go -type=PacketKind
+
+// A PacketKind is a classification of an ARP packet, based on its operation
+// and the patterns of its sender and target addresses.
+type PacketKind uint8
+
+// PacketKind constants which indicate the kind of an ARP packet, as
+// returned by Classify
+const (
+	// KindUnknown indicates a packet with an unknown operation
+	KindUnknown PacketKind = iota
+
+	// KindRequest indicates an ordinary ARP request
+	KindRequest
+
+	// KindReply indicates an ordinary ARP reply
+	KindReply
+
+	// KindGratuitousRequest indicates an ARP request in which the sender
+	// and target IPv4 addresses are equal
+	KindGratuitousRequest
+
+	// KindGratuitousReply indicates an ARP reply in which the sender and
+	// target IPv4 addresses are equal
+	KindGratuitousReply
+
+	// KindProbe indicates an RFC 5227 ARP probe: an ARP request with an
+	// all-zero sender IPv4 address
+	KindProbe
+
+	// KindAnnouncement indicates an RFC 5227 ARP announcement: a gratuitous
+	// ARP request with an all-zero target hardware address
+	KindAnnouncement
+)
+
+// Classify determines the PacketKind of p, using its operation and the
+// patterns of its sender and target addresses.
+func Classify(p *Packet) PacketKind {
+	switch p.Operation {
+	case OperationRequest:
+		if allZero(p.SenderIP) {
+			return KindProbe
+		}
+
+		if p.SenderIP.Equal(p.TargetIP) {
+			if allZero(p.TargetMAC) {
+				return KindAnnouncement
+			}
+
+			return KindGratuitousRequest
+		}
+
+		return KindRequest
+	case OperationReply:
+		if p.SenderIP.Equal(p.TargetIP) {
+			return KindGratuitousReply
+		}
+
+		return KindReply
+	default:
+		return KindUnknown
+	}
+}
+
+// IsProbe reports whether p is an RFC 5227 ARP probe: an ARP request with
+// an all-zero sender IPv4 address and target hardware address, and a
+// non-zero target IPv4 address.
+//
+// IsProbe is stricter than Classify, which reports KindProbe for any
+// request with an all-zero sender IPv4 address.
+func (p *Packet) IsProbe() bool {
+	return p.Operation == OperationRequest &&
+		p.SenderIP.Equal(net.IPv4zero) &&
+		allZero(p.TargetMAC) &&
+		!allZero(p.TargetIP)
+}
+
+// allZero determines if every byte in b is zero
+func allZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,197 @@
+package arp
+
+import (
+	"net"
+	"testing"
+
+	"github.com/caser789/ethernet"
+)
+
+func TestClassify(t *testing.T) {
+	zeroMAC := net.HardwareAddr{0, 0, 0, 0, 0, 0}
+	mac := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	ip1 := net.IP{192, 168, 1, 10}
+	ip2 := net.IP{192, 168, 1, 1}
+
+	var tests = []struct {
+		desc string
+		p    *Packet
+		k    PacketKind
+	}{
+		{
+			desc: "unknown operation",
+			p: &Packet{
+				Operation: 3,
+				SenderMAC: mac,
+				SenderIP:  ip1,
+				TargetMAC: zeroMAC,
+				TargetIP:  ip2,
+			},
+			k: KindUnknown,
+		},
+		{
+			desc: "request",
+			p: &Packet{
+				Operation: OperationRequest,
+				SenderMAC: mac,
+				SenderIP:  ip1,
+				TargetMAC: ethernet.Broadcast,
+				TargetIP:  ip2,
+			},
+			k: KindRequest,
+		},
+		{
+			desc: "reply",
+			p: &Packet{
+				Operation: OperationReply,
+				SenderMAC: mac,
+				SenderIP:  ip1,
+				TargetMAC: zeroMAC,
+				TargetIP:  ip2,
+			},
+			k: KindReply,
+		},
+		{
+			desc: "gratuitous request",
+			p: &Packet{
+				Operation: OperationRequest,
+				SenderMAC: mac,
+				SenderIP:  ip1,
+				TargetMAC: ethernet.Broadcast,
+				TargetIP:  ip1,
+			},
+			k: KindGratuitousRequest,
+		},
+		{
+			desc: "gratuitous reply",
+			p: &Packet{
+				Operation: OperationReply,
+				SenderMAC: mac,
+				SenderIP:  ip1,
+				TargetMAC: mac,
+				TargetIP:  ip1,
+			},
+			k: KindGratuitousReply,
+		},
+		{
+			desc: "probe",
+			p: &Packet{
+				Operation: OperationRequest,
+				SenderMAC: mac,
+				SenderIP:  net.IPv4zero.To4(),
+				TargetMAC: zeroMAC,
+				TargetIP:  ip1,
+			},
+			k: KindProbe,
+		},
+		{
+			desc: "announcement",
+			p: &Packet{
+				Operation: OperationRequest,
+				SenderMAC: mac,
+				SenderIP:  ip1,
+				TargetMAC: zeroMAC,
+				TargetIP:  ip1,
+			},
+			k: KindAnnouncement,
+		},
+	}
+
+	for i, tt := range tests {
+		if want, got := tt.k, Classify(tt.p); want != got {
+			t.Fatalf("[%02d] test %q, unexpected PacketKind: %v != %v",
+				i, tt.desc, want, got)
+		}
+	}
+}
+
+func TestPacketIsProbe(t *testing.T) {
+	zeroMAC := net.HardwareAddr{0, 0, 0, 0, 0, 0}
+	mac := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	ip1 := net.IP{192, 168, 1, 10}
+	ip2 := net.IP{192, 168, 1, 1}
+
+	var tests = []struct {
+		desc string
+		p    *Packet
+		ok   bool
+	}{
+		{
+			desc: "probe",
+			p: &Packet{
+				Operation: OperationRequest,
+				SenderMAC: mac,
+				SenderIP:  net.IPv4zero.To4(),
+				TargetMAC: zeroMAC,
+				TargetIP:  ip1,
+			},
+			ok: true,
+		},
+		{
+			desc: "gratuitous request",
+			p: &Packet{
+				Operation: OperationRequest,
+				SenderMAC: mac,
+				SenderIP:  ip1,
+				TargetMAC: zeroMAC,
+				TargetIP:  ip1,
+			},
+		},
+		{
+			desc: "request",
+			p: &Packet{
+				Operation: OperationRequest,
+				SenderMAC: mac,
+				SenderIP:  ip1,
+				TargetMAC: ethernet.Broadcast,
+				TargetIP:  ip2,
+			},
+		},
+		{
+			desc: "zero sender with broadcast target MAC",
+			p: &Packet{
+				Operation: OperationRequest,
+				SenderMAC: mac,
+				SenderIP:  net.IPv4zero.To4(),
+				TargetMAC: ethernet.Broadcast,
+				TargetIP:  ip1,
+			},
+		},
+		{
+			desc: "zero sender and target IP",
+			p: &Packet{
+				Operation: OperationRequest,
+				SenderMAC: mac,
+				SenderIP:  net.IPv4zero.To4(),
+				TargetMAC: zeroMAC,
+				TargetIP:  net.IPv4zero.To4(),
+			},
+		},
+		{
+			desc: "reply",
+			p: &Packet{
+				Operation: OperationReply,
+				SenderMAC: mac,
+				SenderIP:  net.IPv4zero.To4(),
+				TargetMAC: zeroMAC,
+				TargetIP:  ip1,
+			},
+		},
+	}
+
+	for i, tt := range tests {
+		if want, got := tt.ok, tt.p.IsProbe(); want != got {
+			t.Fatalf("[%02d] test %q, unexpected probe result: %v != %v",
+				i, tt.desc, want, got)
+		}
+	}
+}
+
+func TestPacketKindString(t *testing.T) {
+	if want, got := "KindAnnouncement", KindAnnouncement.String(); want != got {
+		t.Fatalf("unexpected string: %q != %q", want, got)
+	}
+	if want, got := "PacketKind(100)", PacketKind(100).String(); want != got {
+		t.Fatalf("unexpected string: %q != %q", want, got)
+	}
+}
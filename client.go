@@ -1,8 +1,15 @@
 package arp
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"fmt"
+	"io"
 	"net"
+	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/caser789/ethernet"
@@ -13,68 +20,399 @@ var (
 	// errNoIPv4Addr is returned when an interface does not have an IPv4
 	// address
 	errNoIPv4Addr = errors.New("no IPv4 address available for interface")
+
+	// ErrNoIPv4Host is returned when a hostname passed to ResolveHost
+	// does not resolve to an IPv4 address
+	ErrNoIPv4Host = errors.New("host does not resolve to an IPv4 address")
+
+	// ErrNotOnLink is returned when an IPv4 address is not within any of
+	// the IPv4 subnets configured on the Client's network interface, and
+	// thus cannot be resolved using ARP
+	ErrNotOnLink = errors.New("IPv4 address is not on link")
+
+	// ErrInterfaceNotFound is returned by Refresh when the Client's network
+	// interface no longer exists
+	ErrInterfaceNotFound = errors.New("network interface not found")
+
+	// ErrRefreshUnsupported is returned by Refresh when the Client's socket
+	// must be reopened, but the Client was not created using Dial
+	ErrRefreshUnsupported = errors.New("client socket cannot be reopened")
+
+	// ErrClosed is returned when reading from or refreshing a Client which
+	// has been closed, including by a read which was in progress when
+	// Close was called
+	ErrClosed = errors.New("use of closed client")
+
+	// ErrInsufficientPrivilege is matched by the *PrivilegeError returned
+	// by Dial when the operating system denies permission to open a raw
+	// socket
+	ErrInsufficientPrivilege = errors.New("insufficient privileges to open raw socket")
+
+	// ErrResolveTimeout is returned by ResolveTimeout when no host replies
+	// before the timeout expires
+	ErrResolveTimeout = errors.New("no ARP reply received before timeout")
+
+	// ErrNoTrustedResponder is returned by ResolveTrusted when replies were
+	// received before the timeout, but none from a hardware address with
+	// an allowed OUI
+	ErrNoTrustedResponder = errors.New("no ARP reply received from a trusted hardware address")
+
+	// ErrNotLocalTarget is returned by ReplySelf when a request's target
+	// IPv4 address is not the Client's IPv4 address
+	ErrNotLocalTarget = errors.New("request target is not the client's IPv4 address")
+
+	// ErrInterfaceNoMAC is returned by Dial and New when the network
+	// interface has no hardware address, such as a loopback or tun
+	// interface, and thus cannot send or receive ARP packets
+	ErrInterfaceNoMAC = errors.New("network interface has no hardware address")
+
+	// ErrMACLengthMismatch is returned, wrapped with both lengths, when
+	// writing a Packet whose hardware address length differs from that of
+	// the Client's network interface. See SetAllowForeignMedium.
+	ErrMACLengthMismatch = errors.New("packet hardware address length does not match network interface")
+
+	// ErrIPv6Only is returned by Warning when the Client's network
+	// interface has IPv6 addresses, but no IPv4 address
+	ErrIPv6Only = errors.New("interface has no IPv4 address; ARP is IPv4-only")
+)
+
+// A PrivilegeError is returned by Dial and DialProtocol when the operating
+// system denies permission to open a raw socket. On Linux, opening a raw
+// socket requires running as root, or the CAP_NET_RAW capability.
+//
+// A PrivilegeError matches ErrInsufficientPrivilege using errors.Is, and
+// wraps the underlying error returned by the operating system.
+type PrivilegeError struct {
+	// Err is the underlying error
+	Err error
+}
+
+// Error implements error.
+func (e *PrivilegeError) Error() string {
+	return fmt.Sprintf("%v (requires root or CAP_NET_RAW): %v",
+		ErrInsufficientPrivilege, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *PrivilegeError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrInsufficientPrivilege.
+func (e *PrivilegeError) Is(target error) bool {
+	return target == ErrInsufficientPrivilege
+}
+
+// wrapListenError wraps err in a *PrivilegeError if it indicates that the
+// caller does not have permission to open a raw socket
+func wrapListenError(err error) error {
+	if errors.Is(err, os.ErrPermission) {
+		return &PrivilegeError{Err: err}
+	}
+
+	return err
+}
+
+var (
+	// interfaceByName and interfaceAddrs retrieve network interface
+	// information from the operating system. They are variables so tests
+	// can replace them.
+	interfaceByName = net.InterfaceByName
+	interfaceAddrs  = func(ifi *net.Interface) ([]net.Addr, error) {
+		return ifi.Addrs()
+	}
 )
 
 // protocolARP is the uint16 EtherType representation of ARP (Address
 // Resolution Protocol, RFC 826).
 const protocolARP = 0x0806
 
+// EtherTypeRARP is the EtherType used by RARP (Reverse Address Resolution
+// Protocol, RFC 903). It may be passed to DialProtocol to send and receive
+// RARP packets.
+const EtherTypeRARP ethernet.EtherType = 0x8035
+
+// requestIDTTL is the amount of time after which a request sent by
+// RequestID is no longer considered outstanding
+const requestIDTTL = 5 * time.Second
+
+// DefendInterval is the minimum amount of time between announcements sent
+// by Defend for the same IPv4 address, as specified by RFC 5227
+const DefendInterval = 10 * time.Second
+
+// flushTimeout is the amount of time Flush waits for each queued frame
+// before deciding that no more frames are queued
+const flushTimeout = 1 * time.Millisecond
+
+// DefaultReadBufferSize is the default size of the buffer used by a Client
+// to read a single ethernet frame. It accommodates the largest possible ARP
+// packet, which uses 255 byte hardware and protocol addresses, encapsulated
+// in an ethernet frame with up to two 802.1Q VLAN tags.
+const DefaultReadBufferSize = 14 + (2 * 4) + MaxPacketLen
+
 // A Client is an ARP client, which can be used to send and receive
-// ARP packets
+// ARP packets.
+//
+// A Client is safe for concurrent use. Reads and writes are serialized
+// independently: methods which read packets, such as Read and Resolve,
+// take turns using the socket, while methods which write packets, such as
+// Request and WriteTo, may proceed while a read is in progress. Settings
+// such as SetStrictValidation and SetLogger may also be changed while the
+// Client is in use, and apply to subsequent reads and writes.
 type Client struct {
-	ifi *net.Interface
-	ip  net.IP
-	p   net.PacketConn
+	ifi     *net.Interface
+	ip      net.IP
+	subnets []*net.IPNet
+	p       net.PacketConn
+
+	// ipv6Only is set when the interface has IPv6 addresses, but no IPv4
+	// address
+	ipv6Only bool
+
+	// listen reopens the Client's socket on the specified interface. It is
+	// only set for Clients created using Dial.
+	listen func(ifi *net.Interface) (net.PacketConn, error)
+
+	// proto is the EtherType of packets sent and received by the Client.
+	// If zero, ARP is used.
+	proto ethernet.EtherType
+
+	// smu guards the settings below, so they may be changed while the
+	// Client is in use
+	smu sync.RWMutex
+
+	bufSize int
+
+	// srcMAC, if set, overrides the interface's hardware address as the
+	// sender of packets generated by the Client
+	srcMAC net.HardwareAddr
+
+	// strictValidation causes packets which fail Packet.ValidateStrict to
+	// be discarded when reading
+	strictValidation bool
+
+	// allowForeignMedium permits writing packets whose hardware address
+	// length differs from that of the interface
+	allowForeignMedium bool
+
+	// log receives diagnostic messages, if set
+	log Logger
+
+	// imu guards lastID, the ID most recently assigned by RequestID, and
+	// ids, which maps the target IPv4 address of each outstanding request
+	// sent by RequestID to its ID
+	imu    sync.Mutex
+	lastID uint64
+	ids    map[string]outstandingRequest
+
+	// rmu serializes reads, so a method which reads multiple packets
+	// while waiting for a match cannot have its packets consumed by
+	// another reader
+	rmu sync.Mutex
+
+	// wmu serializes writes, so a per-write deadline applied by
+	// WriteToTimeout does not affect other writes
+	wmu sync.Mutex
+
+	// closeOnce ensures the socket is only closed once, and closed is set
+	// to 1 once Close has been called
+	closeOnce sync.Once
+	closed    int32
+
+	// dmu guards deadline, the deadline most recently set using one of the
+	// SetDeadline methods, for use by DeadlineContext, and readDeadline,
+	// the read deadline most recently set by the caller
+	dmu          sync.Mutex
+	deadline     time.Time
+	readDeadline time.Time
 }
 
+// An Option configures a Client when it is created by Dial, DialProtocol,
+// or New.
+type Option func(c *Client)
+
 // Dial creates a new Client using the specified network interface.
 // Dial retrieves the IPv4 address of the interface and binds a raw socket
-// to send and receive ARP packets
-func Dial(ifi *net.Interface) (*Client, error) {
-	// Open raw socket to send and receive ARP packets using ethernet frames
-	p, err := raw.ListenPacket(ifi, protocolARP)
+// to send and receive ARP packets. Any Options are applied to the Client
+// before it is returned.
+func Dial(ifi *net.Interface, opts ...Option) (*Client, error) {
+	return DialProtocol(ifi, protocolARP, opts...)
+}
+
+// DialProtocol creates a new Client in the same way as Dial, but binds its
+// raw socket to the specified EtherType, rather than ARP. The Client writes
+// frames with this EtherType, and only reads frames with this EtherType.
+//
+// The operating system only delivers frames matching the socket's
+// protocol, so this is required to receive RARP packets, using
+// EtherTypeRARP. RARP packets share the ARP packet format, but use
+// operations 3 (request reverse) and 4 (reply reverse).
+func DialProtocol(ifi *net.Interface, proto ethernet.EtherType, opts ...Option) (*Client, error) {
+	// Fail before opening a socket which could never be used
+	if len(ifi.HardwareAddr) == 0 {
+		return nil, ErrInterfaceNoMAC
+	}
+
+	listen := func(ifi *net.Interface) (net.PacketConn, error) {
+		// Open raw socket to send and receive packets using ethernet frames
+		p, err := raw.ListenPacket(ifi, raw.Protocol(proto))
+		if err != nil {
+			return nil, wrapListenError(err)
+		}
+
+		return p, nil
+	}
+
+	p, err := listen(ifi)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := New(ifi, p, opts...)
 	if err != nil {
 		return nil, err
 	}
 
-	return New(ifi, p)
+	c.listen = listen
+	c.proto = proto
+	return c, nil
 }
 
 // New creates a new Client using the specified network interface
 // and net.Conn. This allows the caller to define exactly how they bind to the
 // net.Conn. This is most useful to define what protocol to pass to socket(7)
 //
+// Interface addresses which cannot be parsed are skipped, unless no usable
+// IPv4 address remains, in which case the parse error is returned. If the
+// interface has no hardware address, ErrInterfaceNoMAC is returned. Any
+// Options are applied to the Client before it is returned.
+//
 // In most cases, callers would be better off calling Dial.
-func New(ifi *net.Interface, p net.PacketConn) (*Client, error) {
+func New(ifi *net.Interface, p net.PacketConn, opts ...Option) (*Client, error) {
+	if len(ifi.HardwareAddr) == 0 {
+		return nil, ErrInterfaceNoMAC
+	}
+
 	// Check for usable IPv4 addresses for the client
 	addrs, err := ifi.Addrs()
 	if err != nil {
 		return nil, err
 	}
 
-	return newClient(ifi, p, addrs)
+	return newClient(ifi, p, addrs, opts...)
 }
 
 // newClient is the internal, generic implementation of newClient. It is used
 // to allow an arbitrary net.PacketConn to be used in a client, so testing
 // is easier to accomplish
-func newClient(ifi *net.Interface, p net.PacketConn, addrs []net.Addr) (*Client, error) {
+func newClient(ifi *net.Interface, p net.PacketConn, addrs []net.Addr, opts ...Option) (*Client, error) {
 	ip, err := firstIPv4Addr(addrs)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Client{
-		ifi: ifi,
-		ip:  ip,
-		p:   p,
-	}, nil
+	c := &Client{
+		ifi:      ifi,
+		ip:       ip,
+		ipv6Only: ip == nil && hasIPv6Addr(addrs),
+		subnets:  ipv4Subnets(addrs),
+		p:        p,
+	}
+	for _, o := range opts {
+		o(c)
+	}
+
+	return c, nil
+}
+
+// Refresh retrieves the Client's network interface again by name, and
+// updates the Client's IPv4 address and subnets. If the interface's index
+// or hardware address has changed, such as when a USB network adapter is
+// reconnected, the Client's socket is reopened on the new interface.
+//
+// If the interface no longer exists, ErrInterfaceNotFound is returned, and
+// the Client is left unchanged. If the socket must be reopened but the
+// Client was not created using Dial, ErrRefreshUnsupported is returned. If
+// the Client has been closed, ErrClosed is returned.
+//
+// Refresh waits for any in-progress reads and writes to complete. It is
+// intended to be called periodically, or after a read error, by the
+// goroutine which uses the Client, and must not be called concurrently
+// with methods other than Read and WriteTo and their variants.
+func (c *Client) Refresh() error {
+	if c.isClosed() {
+		return ErrClosed
+	}
+
+	ifi, err := interfaceByName(c.ifi.Name)
+	if err != nil {
+		return ErrInterfaceNotFound
+	}
+
+	addrs, err := interfaceAddrs(ifi)
+	if err != nil {
+		return err
+	}
+	ip, err := firstIPv4Addr(addrs)
+	if err != nil {
+		return err
+	}
+
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	// Check again, so a socket is never opened for a Client closed while
+	// the interface was retrieved
+	if c.isClosed() {
+		return ErrClosed
+	}
+
+	if ifi.Index != c.ifi.Index || !bytes.Equal(ifi.HardwareAddr, c.ifi.HardwareAddr) {
+		if c.listen == nil {
+			return ErrRefreshUnsupported
+		}
+
+		p, err := c.listen(ifi)
+		if err != nil {
+			return err
+		}
+
+		_ = c.p.Close()
+		c.p = p
+	}
+
+	c.ifi = ifi
+	c.ip = ip
+	c.ipv6Only = ip == nil && hasIPv6Addr(addrs)
+	c.subnets = ipv4Subnets(addrs)
+
+	return nil
 }
 
 // Close closes the Client's raw socket and stops sending and receiving
-// ARP packets
+// ARP packets. Any blocked reads are unblocked and return ErrClosed.
+//
+// Close is safe to call multiple times, and from multiple goroutines. Only
+// the first call closes the socket and returns its error; later calls
+// return nil.
 func (c *Client) Close() error {
-	return c.p.Close()
+	err := ErrClosed
+	c.closeOnce.Do(func() {
+		atomic.StoreInt32(&c.closed, 1)
+		err = c.p.Close()
+	})
+	if err == ErrClosed {
+		return nil
+	}
+
+	return err
+}
+
+// isClosed reports whether Close has been called
+func (c *Client) isClosed() bool {
+	return atomic.LoadInt32(&c.closed) == 1
 }
 
 // Request sends an ARP request, asking for the hardware address
@@ -84,135 +422,1701 @@ func (c *Client) Close() error {
 // Unlike Resolve, which provides an easier interface for getting the
 // hardware address, Request allows sending many requests in a row,
 // retrieving the responses afterwards.
+//
+// If ip is not within one of the IPv4 subnets configured on the Client's
+// network interface, ErrNotOnLink is returned, since no reply could ever
+// be received. If ip or the Client's IPv4 address is not an IPv4 address,
+// an error wrapping ErrInvalidIP is returned which names the invalid
+// address.
 func (c *Client) Request(ip net.IP) error {
+	return c.request(ip, ethernet.Broadcast)
+}
+
+// RequestVia sends an ARP request for ip in the same way as Request, but
+// addresses the ethernet frame and the request's target hardware address to
+// dstMAC rather than broadcasting it. This allows directed ARP requests,
+// such as to confirm the address of a known gateway without disturbing
+// other hosts.
+//
+// If dstMAC is not the same length as the hardware address of the Client's
+// network interface, ErrInvalidMAC is returned.
+func (c *Client) RequestVia(ip net.IP, dstMAC net.HardwareAddr) error {
+	if len(dstMAC) != len(c.ifi.HardwareAddr) {
+		return ErrInvalidMAC
+	}
+
+	return c.request(ip, dstMAC)
+}
+
+// request is the internal implementation of Request and RequestVia
+func (c *Client) request(ip net.IP, dstMAC net.HardwareAddr) error {
 	if c.ip == nil {
 		return errNoIPv4Addr
 	}
 
-	// Create ARP packet addressed to broadcast MAC to attempt to find the
-	// hardware address of the input IP address
-	arp, err := NewPacket(OperationRequest, c.ifi.HardwareAddr, c.ip, ethernet.Broadcast, ip)
+	// Report which address is invalid, since NewPacket cannot
+	if c.ip.To4() == nil {
+		return fmt.Errorf("sender IP: %w", ErrInvalidIP)
+	}
+
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return fmt.Errorf("target IP: %w", ErrInvalidIP)
+	}
+
+	// Only check for on-link addresses when subnets are known
+	if len(c.subnets) > 0 && !c.OnLink(ip4) {
+		return ErrNotOnLink
+	}
+
+	// Create ARP packet addressed to the destination MAC to attempt to find
+	// the hardware address of the input IP address
+	arp, err := NewPacket(OperationRequest, c.sourceMAC(), c.ip, dstMAC, ip)
 	if err != nil {
 		return err
 	}
-	return c.WriteTo(arp, ethernet.Broadcast)
+	return c.WriteTo(arp, dstMAC)
+}
+
+// RequestID sends an ARP request for ip in the same way as Request, and
+// returns an ID which identifies the request. IDs increase monotonically
+// for each request sent by the Client, starting from 1.
+//
+// Replies from ip read using ReadInfo are annotated with the ID of the most
+// recent request for ip in PacketInfo.RequestID, allowing callers with
+// several requests in flight to correlate replies with their requests. A
+// request is considered outstanding for 5 seconds after it was sent.
+func (c *Client) RequestID(ip net.IP) (uint64, error) {
+	c.imu.Lock()
+	c.lastID++
+	id := c.lastID
+	c.imu.Unlock()
+
+	// Record the request before sending it, so a fast reply is annotated
+	prev, ok := c.outstanding(ip, id)
+	if err := c.Request(ip); err != nil {
+		c.forget(ip, id, prev, ok)
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// outstandingRequest is a request sent by RequestID which may still be
+// awaiting replies
+type outstandingRequest struct {
+	id   uint64
+	sent time.Time
+}
+
+// outstanding records a request with the specified ID as outstanding for
+// ip, removing any expired requests. It returns the request it replaced,
+// if any.
+func (c *Client) outstanding(ip net.IP, id uint64) (outstandingRequest, bool) {
+	c.imu.Lock()
+	defer c.imu.Unlock()
+
+	if c.ids == nil {
+		c.ids = make(map[string]outstandingRequest)
+	}
+
+	now := time.Now()
+	c.pruneRequestsLocked(now)
+
+	key := ip.String()
+	prev, ok := c.ids[key]
+	c.ids[key] = outstandingRequest{
+		id:   id,
+		sent: now,
+	}
+
+	return prev, ok
+}
+
+// forget removes the request with the specified ID for ip, which could not
+// be sent, restoring the request it replaced, if any
+func (c *Client) forget(ip net.IP, id uint64, prev outstandingRequest, ok bool) {
+	c.imu.Lock()
+	defer c.imu.Unlock()
+
+	key := ip.String()
+	if c.ids[key].id != id {
+		// A later request has since been recorded
+		return
+	}
+
+	if ok {
+		c.ids[key] = prev
+		return
+	}
+
+	delete(c.ids, key)
+}
+
+// replyID returns the ID of the outstanding request which p replies to, or
+// zero if p is not a reply to an outstanding request
+func (c *Client) replyID(p *Packet) uint64 {
+	if p.Operation != OperationReply {
+		return 0
+	}
+
+	c.imu.Lock()
+	defer c.imu.Unlock()
+
+	c.pruneRequestsLocked(time.Now())
+	return c.ids[p.SenderIP.String()].id
+}
+
+// pruneRequestsLocked removes requests which are no longer outstanding at
+// now. c.imu must be held when calling pruneRequestsLocked.
+func (c *Client) pruneRequestsLocked(now time.Time) {
+	for k, r := range c.ids {
+		if now.Sub(r.sent) >= requestIDTTL {
+			delete(c.ids, k)
+		}
+	}
 }
 
 // Resolve performs an ARP request, attempting to retrieve the
-// hardware address of a machine using its IPv4 address. Resolve must not
-// be used concurrently with Read. If you're using read (usually in a loop),
-// you need to use Request instead. Resolve may read more than
-// one message if it receives messages unrelated to the request.
+// hardware address of a machine using its IPv4 address. Resolve may read
+// more than one message if it receives messages unrelated to the request,
+// and those messages are discarded.
+//
+// Resolve holds the Client's read lock until a reply is received, so
+// concurrent calls to Read block until Resolve returns. If you're using
+// Read (usually in a loop), you need to use Request instead.
 func (c *Client) Resolve(ip net.IP) (net.HardwareAddr, error) {
-	err := c.Request(ip)
+	return c.ResolveFunc(ip, func(p *Packet) bool {
+		return matchReply(p, ip)
+	})
+}
+
+// ResolveFunc performs an ARP request for ip in the same way as Resolve,
+// but returns the sender hardware address of the first packet for which
+// match returns true, rather than requiring an ARP reply from ip. This
+// allows accepting responses from nonstandard hosts, such as those which
+// answer using gratuitous requests.
+func (c *Client) ResolveFunc(ip net.IP, match func(p *Packet) bool) (net.HardwareAddr, error) {
+	arp, _, err := c.resolve(ip, match)
 	if err != nil {
 		return nil, err
 	}
 
-	// Loop and wait for replies
-	for {
-		arp, _, err := c.Read()
-		if err != nil {
-			return nil, err
-		}
+	return arp.SenderMAC, nil
+}
 
-		if arp.Operation != OperationReply || !arp.SenderIP.Equal(ip) {
-			continue
+// ResolveFull performs an ARP request in the same way as Resolve, but
+// returns the entire matching ARP reply, together with its ethernet frame.
+//
+// This is useful for diagnostics: for example, an ethernet source address
+// which differs from the ARP sender hardware address may indicate a
+// spoofed reply.
+func (c *Client) ResolveFull(ip net.IP) (*Packet, *ethernet.Frame, error) {
+	return c.resolve(ip, func(p *Packet) bool {
+		return matchReply(p, ip)
+	})
+}
+
+// ResolveMeta contains information about a resolution performed by
+// ResolveWithMeta.
+type ResolveMeta struct {
+	// RTT is the time elapsed between sending the ARP request and reading
+	// the matching reply
+	RTT time.Duration
+
+	// Skipped is the number of ARP packets read which did not match the
+	// request, and were discarded
+	Skipped int
+}
+
+// ResolveWithMeta performs an ARP request in the same way as Resolve, and
+// also returns the round-trip time of the request and the number of
+// unrelated packets discarded while waiting for the reply. This is useful
+// for latency diagnostics.
+func (c *Client) ResolveWithMeta(ip net.IP) (net.HardwareAddr, ResolveMeta, error) {
+	var meta ResolveMeta
+
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+
+	// Begin timing once the read lock is held, so time spent waiting for
+	// other readers is not included in the round-trip time
+	start := time.Now()
+	arp, _, err := c.resolveLocked(ip, func(p *Packet) bool {
+		if !matchReply(p, ip) {
+			meta.Skipped++
+			return false
 		}
 
-		return arp.SenderMAC, nil
+		return true
+	})
+	if err != nil {
+		return nil, ResolveMeta{}, err
 	}
+
+	meta.RTT = time.Since(start)
+	return arp.SenderMAC, meta, nil
 }
 
-// Read reads a single ARP packet and returns it, together with its
-// ethernet frame
-func (c *Client) Read() (*Packet, *ethernet.Frame, error) {
-	buf := make([]byte, 128)
-	for {
-		n, _, err := c.p.ReadFrom(buf)
-		if err != nil {
-			return nil, nil, err
+// A ResolveResult is the result of an asynchronous resolution started by
+// ResolveAsync.
+type ResolveResult struct {
+	// MAC is the resolved hardware address, if Err is nil
+	MAC net.HardwareAddr
+
+	// Err is the error which occurred during resolution, if any
+	Err error
+}
+
+// ResolveAsync performs an ARP request for ip in the same way as Resolve,
+// but in the background. It returns a channel which delivers a single
+// ResolveResult once resolution completes, together with a function which
+// cancels resolution.
+//
+// If resolution is in progress, canceling unblocks its read by setting a
+// read deadline, waits for the background goroutine to exit, and then
+// restores the read deadline most recently set using SetReadDeadline or
+// SetDeadline. If resolution is still waiting for another reader of the
+// Client to finish, canceling does not interrupt that reader, and returns
+// without waiting. If resolution had not completed, a ResolveResult with
+// Err set to context.Canceled is delivered. The cancel function should be
+// called to release resources once the result is no longer needed, and may
+// be called more than once.
+func (c *Client) ResolveAsync(ip net.IP) (<-chan ResolveResult, context.CancelFunc) {
+	// Buffer the result, so the background goroutine never blocks
+	results := make(chan ResolveResult, 1)
+	exited := make(chan struct{})
+
+	// mu guards the state shared by the background goroutine and cancel
+	var (
+		mu          sync.Mutex
+		canceled    bool
+		reading     bool
+		interrupted bool
+	)
+
+	go func() {
+		defer close(exited)
+
+		c.rmu.Lock()
+		defer c.rmu.Unlock()
+
+		mu.Lock()
+		if canceled {
+			mu.Unlock()
+			results <- ResolveResult{Err: context.Canceled}
+			return
+		}
+		reading = true
+		mu.Unlock()
+
+		arp, _, err := c.resolveLocked(ip, func(p *Packet) bool {
+			return matchReply(p, ip)
+		})
+
+		mu.Lock()
+		reading = false
+		if canceled && err != nil {
+			// Canceled, so the error is likely the deadline set by cancel
+			err = context.Canceled
+		}
+		if interrupted {
+			// Restore the caller's deadline before releasing the read
+			// lock, so the next reader is not affected
+			_ = c.restoreReadDeadline()
+		}
+		mu.Unlock()
+
+		var mac net.HardwareAddr
+		if err == nil {
+			mac = arp.SenderMAC
+		}
+
+		results <- ResolveResult{
+			MAC: mac,
+			Err: err,
+		}
+	}()
+
+	cancel := func() {
+		mu.Lock()
+		if canceled {
+			mu.Unlock()
+			return
+		}
+		canceled = true
+
+		// Only interrupt the read while this resolution holds the read
+		// lock, so no other reader can be affected
+		wait := reading
+		if reading {
+			interrupted = true
+			_ = c.p.SetReadDeadline(time.Now())
+		}
+		mu.Unlock()
+
+		if wait {
+			<-exited
 		}
+	}
+
+	return results, cancel
+}
+
+// resolve sends an ARP request for ip, and reads packets until one for
+// which match returns true is received
+func (c *Client) resolve(ip net.IP, match func(p *Packet) bool) (*Packet, *ethernet.Frame, error) {
+	// Acquire the read lock before sending the request, so the reply
+	// cannot be consumed by another reader
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+
+	return c.resolveLocked(ip, match)
+}
+
+// resolveLocked is the implementation of resolve. The caller must hold the
+// read lock.
+func (c *Client) resolveLocked(ip net.IP, match func(p *Packet) bool) (*Packet, *ethernet.Frame, error) {
+	err := c.Request(ip)
+	if err != nil {
+		return nil, nil, err
+	}
 
-		p, eth, err := parsePacket(buf[:n])
+	// Loop and wait for replies
+	for {
+		arp, eth, err := c.read(false)
 		if err != nil {
-			if err == errInvalidARPPacket {
-				continue
+			if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+				c.logf("arp: timed out waiting for reply from %v", ip)
 			}
 
 			return nil, nil, err
 		}
 
-		return p, eth, nil
+		if !match(arp) {
+			continue
+		}
+
+		return arp, eth, nil
 	}
 }
 
-// WriteTo writes a single ARP packet to addr. Note that addr should,
-// but doesn't have to, match the target hardware address of the ARP
-// packet
-func (c *Client) WriteTo(p *Packet, addr net.HardwareAddr) error {
-	pb, err := p.MarshalBinary()
-	if err != nil {
-		return err
-	}
+// IsReachable performs an ARP request for ip in the same way as Resolve,
+// and reports whether the host using ip replied within timeout, together
+// with its hardware address. This is useful for liveness checks, where a
+// host which does not reply is an expected outcome rather than an error.
+//
+// IsReachable also returns false if the request cannot be sent, or reading
+// from the Client's socket fails. IsReachable sets a read deadline for its
+// duration, and restores the caller's read deadline before returning.
+func (c *Client) IsReachable(ip net.IP, timeout time.Duration) (bool, net.HardwareAddr) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
 
-	f := &ethernet.Frame{
-		Destination: addr,
-		Source:      p.SenderMAC,
-		EtherType:   ethernet.EtherTypeARP,
-		Payload:     pb,
+	if err := c.p.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return false, nil
 	}
+	defer c.restoreReadDeadline()
 
-	fb, err := f.MarshalBinary()
+	arp, _, err := c.resolveLocked(ip, func(p *Packet) bool {
+		return matchReply(p, ip)
+	})
 	if err != nil {
-		return err
+		return false, nil
 	}
 
-	_, err = c.p.WriteTo(fb, &raw.Addr{HardwareAddr: addr})
-	return err
+	return true, arp.SenderMAC
 }
 
-// Reply constructs and sends a reply to an ARP request. On the ARP
-// layer, it will be addressed to the sender address of the packet. On
-// the ethernet layer, it will be sent to the actual remote address
-// from which the request was received
+// ResolveTimeout performs an ARP request for ip in the same way as Resolve,
+// but waits at most timeout for a reply. If no host replies in time,
+// ErrResolveTimeout is returned, so callers can distinguish an address
+// which is not in use from other errors, which are returned unchanged.
 //
-// For more fine-grained control, use WriteTo to write a custom
-// response
-func (c *Client) Reply(req *Packet, hwAddr net.HardwareAddr, ip net.IP) error {
-	p, err := NewPacket(OperationReply, hwAddr, ip, req.SenderMAC, req.SenderIP)
-	if err != nil {
-		return err
+// ResolveTimeout sets a read deadline for its duration, and restores the
+// caller's read deadline before returning.
+func (c *Client) ResolveTimeout(ip net.IP, timeout time.Duration) (net.HardwareAddr, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+
+	if err := c.p.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
 	}
+	defer c.restoreReadDeadline()
 
-	return c.WriteTo(p, req.SenderMAC)
-}
+	arp, _, err := c.resolveLocked(ip, func(p *Packet) bool {
+		return matchReply(p, ip)
+	})
+	if err != nil {
+		if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+			return nil, ErrResolveTimeout
+		}
 
-// SetDeadline sets the read and write deadlines associated with the
-// connection
-func (c *Client) SetDeadline(t time.Time) error {
-	return c.p.SetDeadline(t)
-}
+		return nil, err
+	}
 
-// SetReadDeadline sets the deadline for future raw socket read calls
-func (c *Client) SetReadDeadline(t time.Time) error {
-	return c.p.SetReadDeadline(t)
+	return arp.SenderMAC, nil
 }
 
-// SetWriteDeadline sets the deadline for future raw socket write calls
-func (c *Client) SetWriteDeadline(t time.Time) error {
-	return c.p.SetWriteDeadline(t)
-}
+// ResolveTrusted performs an ARP request for ip in the same way as
+// ResolveTimeout, but only accepts replies whose sender hardware address
+// begins with one of allowedOUIs, the organizationally unique identifiers
+// of known-good vendors. Replies from other hardware addresses are treated
+// as potential spoofs, and are ignored.
+//
+// If only untrusted hosts reply within timeout, ErrNoTrustedResponder is
+// returned. If no host replies at all, ErrResolveTimeout is returned.
+//
+// ResolveTrusted sets a read deadline for its duration, and restores the
+// caller's read deadline before returning.
+func (c *Client) ResolveTrusted(ip net.IP, allowedOUIs [][3]byte, timeout time.Duration) (net.HardwareAddr, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
 
-// HardwareAddr fetches the hardware address for the interface associated
-// with the connection
-func (c Client) HardwareAddr() net.HardwareAddr {
-	return c.ifi.HardwareAddr
+	if err := c.p.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	defer c.restoreReadDeadline()
+
+	var untrusted bool
+	arp, _, err := c.resolveLocked(ip, func(p *Packet) bool {
+		if !matchReply(p, ip) {
+			return false
+		}
+
+		if !hasOUI(p.SenderMAC, allowedOUIs) {
+			c.logf("arp: ignoring reply for %v from untrusted %v", ip, p.SenderMAC)
+			untrusted = true
+			return false
+		}
+
+		return true
+	})
+	if err != nil {
+		if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+			if untrusted {
+				return nil, ErrNoTrustedResponder
+			}
+
+			return nil, ErrResolveTimeout
+		}
+
+		return nil, err
+	}
+
+	return arp.SenderMAC, nil
+}
+
+// hasOUI reports whether mac begins with any of ouis
+func hasOUI(mac net.HardwareAddr, ouis [][3]byte) bool {
+	if len(mac) < 3 {
+		return false
+	}
+
+	for _, oui := range ouis {
+		if mac[0] == oui[0] && mac[1] == oui[1] && mac[2] == oui[2] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ResolveRetryDirected performs an ARP request for ip in the same way as
+// Resolve, retrying up to attempts times and waiting up to interval for a
+// reply to each attempt. The first attempt is broadcast, and subsequent
+// attempts are sent directly to fallbackMAC, such as a hardware address
+// previously learned for ip, as with RequestVia. This can succeed on
+// networks which drop or rate limit broadcast traffic. If fallbackMAC is
+// nil, every attempt is broadcast.
+//
+// If no host replies to any attempt, ErrResolveTimeout is returned. If
+// fallbackMAC is not the same length as the hardware address of the
+// Client's network interface, ErrInvalidMAC is returned.
+//
+// ResolveRetryDirected sets a read deadline for each attempt, and restores
+// the caller's read deadline before returning.
+func (c *Client) ResolveRetryDirected(ip net.IP, fallbackMAC net.HardwareAddr, interval time.Duration, attempts int) (net.HardwareAddr, error) {
+	if fallbackMAC != nil && len(fallbackMAC) != len(c.ifi.HardwareAddr) {
+		return nil, ErrInvalidMAC
+	}
+
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+
+	defer c.restoreReadDeadline()
+
+	for i := 0; i < attempts; i++ {
+		dst := ethernet.Broadcast
+		if i > 0 && fallbackMAC != nil {
+			dst = fallbackMAC
+		}
+
+		if err := c.p.SetReadDeadline(time.Now().Add(interval)); err != nil {
+			return nil, err
+		}
+
+		if err := c.request(ip, dst); err != nil {
+			return nil, err
+		}
+
+		for {
+			arp, _, err := c.read(false)
+			if err != nil {
+				if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+					break
+				}
+
+				return nil, err
+			}
+
+			if matchReply(arp, ip) {
+				return arp.SenderMAC, nil
+			}
+		}
+	}
+
+	return nil, ErrResolveTimeout
+}
+
+// ResolveDetectConflict performs an ARP request for ip in the same way as
+// Resolve, and returns the hardware address of the first host to reply.
+// It then continues reading until timeout, and also returns the distinct
+// hardware addresses of any other hosts which reply for ip. More than one
+// replying host indicates an IPv4 address conflict.
+//
+// If no host replies within timeout, the timeout error is returned.
+// ResolveDetectConflict sets a read deadline for its duration, and restores
+// the caller's read deadline before returning.
+func (c *Client) ResolveDetectConflict(ip net.IP, timeout time.Duration) (net.HardwareAddr, []net.HardwareAddr, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+
+	if err := c.p.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, nil, err
+	}
+	defer c.restoreReadDeadline()
+
+	match := func(p *Packet) bool {
+		return matchReply(p, ip)
+	}
+
+	primary, _, err := c.resolveLocked(ip, match)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	seen := map[string]bool{
+		primary.SenderMAC.String(): true,
+	}
+
+	var others []net.HardwareAddr
+	for {
+		arp, _, err := c.read(false)
+		if err != nil {
+			if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+				break
+			}
+
+			return nil, nil, err
+		}
+
+		if !match(arp) || seen[arp.SenderMAC.String()] {
+			continue
+		}
+
+		seen[arp.SenderMAC.String()] = true
+		others = append(others, arp.SenderMAC)
+	}
+
+	return primary.SenderMAC, others, nil
+}
+
+// RequestAndCollect sends a single ARP request for ip, and collects up to n
+// matching replies, stopping early once n replies are received. If n is
+// zero or less, all replies received within timeout are collected.
+//
+// Reaching timeout is not an error: the replies collected so far are
+// returned. This is useful for detecting duplicate IPv4 addresses, where
+// more than one host replies for the same address.
+//
+// RequestAndCollect sets a read deadline for its duration, and restores the
+// caller's read deadline before returning.
+func (c *Client) RequestAndCollect(ip net.IP, n int, timeout time.Duration) ([]*Packet, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+
+	if err := c.p.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	defer c.restoreReadDeadline()
+
+	if err := c.Request(ip); err != nil {
+		return nil, err
+	}
+
+	var ps []*Packet
+	for n <= 0 || len(ps) < n {
+		arp, _, err := c.read(false)
+		if err != nil {
+			if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+				break
+			}
+
+			return nil, err
+		}
+
+		if !matchReply(arp, ip) {
+			continue
+		}
+
+		ps = append(ps, arp)
+	}
+
+	return ps, nil
+}
+
+// A Neighbor is a host discovered by Scan.
+type Neighbor struct {
+	// IP and MAC are the IPv4 and hardware addresses of the host
+	IP  net.IP
+	MAC net.HardwareAddr
+
+	// RTT is the time elapsed between sending the ARP request for IP and
+	// reading the host's first reply
+	RTT time.Duration
+
+	// FirstSeen is the time at which the host's first reply was read
+	FirstSeen time.Time
+}
+
+// Scan sends an ARP request for each of ips, and collects the first reply
+// from each host which replies within timeout. Neighbors are returned in
+// the order their replies were received. Scan returns early once every
+// address has replied.
+//
+// Reaching timeout is not an error: the neighbors discovered so far are
+// returned. Scan sets a read deadline for its duration, and restores the
+// caller's read deadline before returning.
+func (c *Client) Scan(ips []net.IP, timeout time.Duration) ([]Neighbor, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+
+	if err := c.p.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	defer c.restoreReadDeadline()
+
+	// Track when each request was sent, so the RTT of each reply can be
+	// computed
+	sent := make(map[string]time.Time, len(ips))
+	for _, ip := range ips {
+		sent[ip.String()] = time.Now()
+		if err := c.Request(ip); err != nil {
+			return nil, err
+		}
+	}
+
+	var ns []Neighbor
+	for len(sent) > 0 {
+		arp, _, err := c.read(false)
+		if err != nil {
+			if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+				break
+			}
+
+			return nil, err
+		}
+
+		if arp.Operation != OperationReply {
+			continue
+		}
+
+		key := arp.SenderIP.String()
+		start, ok := sent[key]
+		if !ok {
+			continue
+		}
+		delete(sent, key)
+
+		now := time.Now()
+		ns = append(ns, Neighbor{
+			IP:        arp.SenderIP,
+			MAC:       arp.SenderMAC,
+			RTT:       now.Sub(start),
+			FirstSeen: now,
+		})
+	}
+
+	return ns, nil
+}
+
+// Flush reads and discards all frames already queued on the Client's socket,
+// so that a following call to Resolve does not need to skip stale packets.
+// Flush returns as soon as no more frames are immediately available, and
+// does not wait for new frames to arrive.
+//
+// Flush sets a short read deadline for each read, and restores the caller's
+// read deadline before returning.
+func (c *Client) Flush() error {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+
+	defer c.restoreReadDeadline()
+
+	buf := make([]byte, c.readBufferSize())
+	for {
+		if err := c.p.SetReadDeadline(time.Now().Add(flushTimeout)); err != nil {
+			return err
+		}
+
+		if _, _, err := c.p.ReadFrom(buf); err != nil {
+			if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+				return nil
+			}
+
+			return err
+		}
+	}
+}
+
+// RequestStream sends an ARP request for each of ips, and returns a channel
+// which delivers ARP replies from any of ips as they are received, together
+// with a function which stops reading. This allows callers to act on each
+// reply immediately, rather than waiting for all replies to arrive.
+//
+// Requests which cannot be sent, such as for addresses which are not on
+// link, are skipped. Replies are read in the background until the returned
+// function is called, or until reading fails. In either case, the channel
+// is then closed. The returned function must be called to release the
+// background reader, and may be called more than once.
+//
+// While the background reader is running, it competes with other readers
+// of the Client, which may consume the replies instead. Stopping the reader
+// does not interrupt other readers, but waits for any in-progress read by
+// another reader to complete.
+func (c *Client) RequestStream(ips []net.IP) (<-chan *Packet, func()) {
+	want := make(map[string]bool, len(ips))
+	for _, ip := range ips {
+		want[ip.String()] = true
+	}
+
+	replies := make(chan *Packet)
+	exited := make(chan struct{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// Begin reading before sending requests, so fast replies are not missed
+	go func() {
+		defer close(exited)
+		defer close(replies)
+
+		_ = readUntil(ctx, c, func(p *Packet, _ *ethernet.Frame) error {
+			if p.Operation != OperationReply || !want[p.SenderIP.String()] {
+				return nil
+			}
+
+			select {
+			case replies <- p:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+
+	for _, ip := range ips {
+		_ = c.Request(ip)
+	}
+
+	stop := func() {
+		cancel()
+		<-exited
+	}
+
+	return replies, stop
+}
+
+// matchReply determines if p is an ARP reply from the host using ip
+func matchReply(p *Packet, ip net.IP) bool {
+	return Match(p, OperationReply, ip, nil)
+}
+
+// ResolveHost resolves host to an IPv4 address, and then performs an ARP
+// request to retrieve the hardware address of the machine using that
+// address. host may be a hostname or a literal IPv4 address.
+//
+// If host does not resolve to an IPv4 address, ErrNoIPv4Host is returned.
+// Because ARP only operates on the local link, if the address is not within
+// one of the Client's interface subnets, ErrNotOnLink is returned.
+func (c *Client) ResolveHost(host string) (net.HardwareAddr, error) {
+	addr, err := net.ResolveIPAddr("ip", host)
+	if err != nil {
+		return nil, err
+	}
+
+	ip := addr.IP.To4()
+	if ip == nil {
+		return nil, ErrNoIPv4Host
+	}
+
+	return c.Resolve(ip)
+}
+
+// Read reads a single ARP packet and returns it, together with its
+// ethernet frame.
+//
+// If a frame completely fills the read buffer, it was likely truncated, and
+// io.ErrShortBuffer is returned rather than attempting to decode it. Use
+// SetReadBufferSize to read larger frames.
+func (c *Client) Read() (*Packet, *ethernet.Frame, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+
+	return c.read(false)
+}
+
+// ReadStrict reads a single ethernet frame in the same way as Read, but
+// rather than silently discarding frames which do not contain an ARP
+// packet, it returns them together with a *NotARPError. This allows
+// monitoring tools to observe other traffic received by the Client.
+func (c *Client) ReadStrict() (*Packet, *ethernet.Frame, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+
+	return c.read(true)
+}
+
+// PacketInfo contains metadata about the ethernet frame which carried an
+// ARP packet, as returned by ReadInfo.
+type PacketInfo struct {
+	// VLAN is the ID of the outermost 802.1Q VLAN tag of the frame, or
+	// zero if the frame was not tagged.
+	VLAN uint16
+
+	// FrameLen is the length of the frame in bytes, as read from the
+	// socket.
+	FrameLen int
+
+	// Timestamp is the time at which the frame was read.
+	Timestamp time.Time
+
+	// Source is the ethernet source address of the frame.
+	Source net.HardwareAddr
+
+	// RequestID is the ID returned by RequestID for the outstanding
+	// request which the packet replies to, or zero if the packet is not a
+	// reply to such a request.
+	RequestID uint64
+}
+
+// ReadInfo reads a single ARP packet in the same way as Read, but returns
+// metadata about its ethernet frame, such as its VLAN and length, rather
+// than the frame itself. This is useful for correlating packets when
+// monitoring a network, or replies with requests sent using RequestID.
+func (c *Client) ReadInfo() (*Packet, *PacketInfo, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+
+	p, eth, b, err := c.readFrame(false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info := &PacketInfo{
+		FrameLen:  len(b),
+		Timestamp: time.Now(),
+		Source:    eth.Source,
+		RequestID: c.replyID(p),
+	}
+	if len(eth.VLAN) > 0 {
+		info.VLAN = eth.VLAN[0].ID
+	}
+
+	return p, info, nil
+}
+
+// read is the internal implementation of Read and ReadStrict. If strict is
+// true, non-ARP frames are returned with a *NotARPError instead of being
+// discarded. The caller must hold the read lock.
+func (c *Client) read(strict bool) (*Packet, *ethernet.Frame, error) {
+	p, eth, _, err := c.readFrame(strict)
+	return p, eth, err
+}
+
+// ReadRaw reads a single ARP packet in the same way as Read, but also
+// returns a copy of the exact bytes of the ethernet frame read from the
+// socket, including any padding. This is useful for audit logging, where
+// marshaling the decoded frame may not reproduce the original bytes.
+func (c *Client) ReadRaw() (*Packet, *ethernet.Frame, []byte, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+
+	p, eth, b, err := c.readFrame(false)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return p, eth, append([]byte(nil), b...), nil
+}
+
+// readFrame reads a frame in the same way as read, but also returns the
+// bytes of the frame, which share storage with the returned Packet. The
+// caller must hold the read lock.
+func (c *Client) readFrame(strict bool) (*Packet, *ethernet.Frame, []byte, error) {
+	if c.isClosed() {
+		return nil, nil, nil, ErrClosed
+	}
+
+	buf := make([]byte, c.readBufferSize())
+	for {
+		n, _, err := c.p.ReadFrom(buf)
+		if err != nil {
+			// The socket's own error for a read interrupted by Close
+			// varies by platform
+			if c.isClosed() {
+				return nil, nil, nil, ErrClosed
+			}
+
+			return nil, nil, nil, err
+		}
+		if n == len(buf) {
+			return nil, nil, nil, io.ErrShortBuffer
+		}
+
+		p, eth, err := parsePacketType(buf[:n], c.etherType())
+		if err != nil {
+			if err == errInvalidARPPacket {
+				if strict {
+					return nil, eth, buf[:n], &NotARPError{Frame: eth}
+				}
+
+				continue
+			}
+
+			c.logf("arp: failed to parse packet: %v", err)
+			return nil, nil, nil, err
+		}
+
+		// Drop malformed or spoofed packets before they reach the caller
+		if c.strict() {
+			if err := p.ValidateStrict(); err != nil {
+				c.logf("arp: dropped packet from %v: %v", eth.Source, err)
+				continue
+			}
+		}
+
+		return p, eth, buf[:n], nil
+	}
+}
+
+// ReadOp reads ARP packets until one with the specified Operation is
+// received, and returns it together with its ethernet frame. Packets with
+// other operations are discarded. If op is zero, ReadOp behaves like Read
+// and returns any ARP packet.
+func (c *Client) ReadOp(op Operation) (*Packet, *ethernet.Frame, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+
+	for {
+		p, eth, err := c.read(false)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if op != 0 && p.Operation != op {
+			continue
+		}
+
+		return p, eth, nil
+	}
+}
+
+// WriteTo writes a single ARP packet to addr. Note that addr should,
+// but doesn't have to, match the target hardware address of the ARP
+// packet.
+//
+// If addr or the packet's sender hardware address is shorter than an
+// ethernet address, ErrInvalidMAC is returned.
+func (c *Client) WriteTo(p *Packet, addr net.HardwareAddr) error {
+	_, err := c.writeTo(p, addr, nil, 0)
+	return err
+}
+
+// WriteToN writes a single ARP packet to addr in the same way as WriteTo,
+// and returns the number of bytes written, including the ethernet frame
+// header.
+func (c *Client) WriteToN(p *Packet, addr net.HardwareAddr) (int, error) {
+	return c.writeTo(p, addr, nil, 0)
+}
+
+// WriteToTimeout writes a single ARP packet to addr in the same way as
+// WriteTo, but fails with a timeout error if the write does not complete
+// within timeout.
+//
+// The timeout applies only to this write. Once the write completes, the
+// write deadline is cleared, replacing any deadline previously set using
+// SetDeadline or SetWriteDeadline.
+func (c *Client) WriteToTimeout(p *Packet, addr net.HardwareAddr, timeout time.Duration) error {
+	_, err := c.writeTo(p, addr, nil, timeout)
+	return err
+}
+
+// WriteToVLAN writes a single ARP packet to addr, wrapped in an ethernet
+// frame carrying an 802.1Q VLAN tag with the specified VLAN ID. This is
+// useful when sending ARP packets on a switch trunk port.
+//
+// If vlanID is too large (greater than 4094), ethernet.ErrInvalidVLAN is
+// returned
+func (c *Client) WriteToVLAN(p *Packet, vlanID uint16, addr net.HardwareAddr) error {
+	_, err := c.writeTo(p, addr, []*ethernet.VLAN{{
+		ID: vlanID,
+	}}, 0)
+	return err
+}
+
+// writeTo is the internal implementation of WriteTo and its variants. It
+// marshals p into an ethernet frame with zero or more VLAN tags, and writes
+// the frame to addr, returning the number of bytes written. If timeout is
+// greater than zero, it is applied as a write deadline for this write only.
+func (c *Client) writeTo(p *Packet, addr net.HardwareAddr, vlans []*ethernet.VLAN, timeout time.Duration) (int, error) {
+	// Both addresses fill a 6 byte field in the ethernet header
+	if len(addr) < 6 || len(p.SenderMAC) < 6 {
+		return 0, ErrInvalidMAC
+	}
+
+	var fb []byte
+	if len(vlans) == 0 {
+		// Marshal untagged frames, the common case, into a pooled buffer
+		bp := framePool.Get().(*[]byte)
+		defer framePool.Put(bp)
+
+		var err error
+		fb, err = p.marshalFrame(*bp, addr, c.etherType())
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		f, err := p.Frame(addr)
+		if err != nil {
+			return 0, err
+		}
+		f.VLAN = vlans
+		f.EtherType = c.etherType()
+
+		fb, err = f.MarshalBinary()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	// Check under the write lock, as Refresh may replace the interface
+	if err := c.checkMedium(p); err != nil {
+		return 0, err
+	}
+
+	if timeout > 0 {
+		if err := c.p.SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+			return 0, err
+		}
+		defer c.p.SetWriteDeadline(time.Time{})
+	}
+
+	return c.p.WriteTo(fb, &raw.Addr{HardwareAddr: addr})
+}
+
+// checkMedium returns an error wrapping ErrMACLengthMismatch if p was
+// built for a medium other than that of the Client's network interface,
+// unless foreign media are allowed. The caller must hold the write lock.
+func (c *Client) checkMedium(p *Packet) error {
+	c.smu.RLock()
+	allow := c.allowForeignMedium
+	c.smu.RUnlock()
+
+	if allow || len(c.ifi.HardwareAddr) == 0 {
+		return nil
+	}
+
+	if ml := len(c.ifi.HardwareAddr); int(p.MACLength) != ml {
+		return fmt.Errorf("packet uses %d byte hardware addresses, interface %q uses %d: %w",
+			p.MACLength, c.ifi.Name, ml, ErrMACLengthMismatch)
+	}
+
+	return nil
+}
+
+// framePool is a pool of buffers large enough to contain any untagged
+// ethernet frame carrying an ARP packet, so writes do not allocate
+var framePool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 14+MaxPacketLen)
+		return &b
+	},
+}
+
+// WriteFrame writes the raw ethernet frame fb directly to addr, and returns
+// the number of bytes written. This is useful for replaying captured
+// traffic, or for testing peers against malformed input.
+//
+// No validation is performed on fb: the caller is responsible for ensuring
+// it is a correct ethernet frame.
+func (c *Client) WriteFrame(fb []byte, addr net.HardwareAddr) (int, error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	return c.p.WriteTo(fb, &raw.Addr{HardwareAddr: addr})
+}
+
+// Reply constructs and sends a reply to an ARP request. On the ARP
+// layer, it will be addressed to the sender address of the packet. On
+// the ethernet layer, it will be sent to the actual remote address
+// from which the request was received
+//
+// If ip or the sender IPv4 address of req is not an IPv4 address, an error
+// wrapping ErrInvalidIP is returned which names the invalid address.
+//
+// For more fine-grained control, use NewReplyFor and WriteTo to write
+// a custom response
+func (c *Client) Reply(req *Packet, hwAddr net.HardwareAddr, ip net.IP) error {
+	// Report which address is invalid, since NewReplyFor cannot
+	if ip.To4() == nil {
+		return fmt.Errorf("sender IP: %w", ErrInvalidIP)
+	}
+	if req.SenderIP.To4() == nil {
+		return fmt.Errorf("target IP: %w", ErrInvalidIP)
+	}
+
+	p, err := NewReplyFor(req, hwAddr, ip)
+	if err != nil {
+		return err
+	}
+
+	return c.WriteTo(p, req.SenderMAC)
+}
+
+// RespondSelf reads ARP requests and replies to any which ask for the
+// hardware address of one of the IPv4 addresses currently configured on
+// the Client's network interface, in the same way as Respond. Requests
+// for any other address are never answered, so RespondSelf is a safe
+// default responder which only defends the host's own addresses.
+//
+// If the interface has no IPv4 addresses, an error is returned.
+func (c *Client) RespondSelf() error {
+	addrs, err := interfaceAddrs(c.ifi)
+	if err != nil {
+		return err
+	}
+
+	ips := ipv4Addrs(addrs)
+	if len(ips) == 0 {
+		return errNoIPv4Addr
+	}
+
+	return c.Respond(ips...)
+}
+
+// ReplySelf replies to req on behalf of the Client itself, using the
+// Client's hardware and IPv4 addresses, in the same way as Reply. If the
+// target IPv4 address of req is not the Client's IPv4 address, no reply is
+// sent and ErrNotLocalTarget is returned.
+func (c *Client) ReplySelf(req *Packet) error {
+	if c.ip == nil {
+		return errNoIPv4Addr
+	}
+
+	if !req.TargetIP.Equal(c.ip) {
+		return ErrNotLocalTarget
+	}
+
+	return c.Reply(req, c.sourceMAC(), c.ip)
+}
+
+// Respond reads ARP requests and replies to any which ask for the hardware
+// address of one of ips, claiming those addresses using the hardware
+// address of the Client's network interface, or the address set using
+// SetSourceMAC. Respond continues until an
+// error occurs while reading or replying, and returns that error.
+//
+// Requests read by Respond are not available to concurrent calls to Read.
+func (c *Client) Respond(ips ...net.IP) error {
+	owns := func(target net.IP) bool {
+		for _, ip := range ips {
+			if target.Equal(ip) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return c.RespondFunc(owns, c.sourceMAC())
+}
+
+// RespondFunc reads ARP requests and replies to any whose target IPv4
+// address satisfies owns, claiming the address using mac. This allows
+// ownership to be decided dynamically, such as for a range of addresses or
+// addresses stored elsewhere. RespondFunc continues until an error occurs
+// while reading or replying, and returns that error.
+//
+// Requests read by RespondFunc are not available to concurrent calls to
+// Read.
+func (c *Client) RespondFunc(owns func(ip net.IP) bool, mac net.HardwareAddr) error {
+	return c.RespondComputed(func(ip net.IP) net.HardwareAddr {
+		if !owns(ip) {
+			return nil
+		}
+
+		return mac
+	})
+}
+
+// RespondComputed reads ARP requests and replies to each using the hardware
+// address returned by fn for the request's target IPv4 address. If fn
+// returns nil, the request is ignored. Combined with LocallyAdministeredMAC,
+// this can simulate a densely populated subnet, such as for stress testing
+// neighbor tables. RespondComputed continues until an error occurs while
+// reading or replying, and returns that error.
+//
+// Requests sent from the hardware address of the Client's network
+// interface, such as those looped back by a hub or mirror port, are never
+// answered.
+//
+// Requests read by RespondComputed are not available to concurrent calls to
+// Read.
+func (c *Client) RespondComputed(fn func(ip net.IP) net.HardwareAddr) error {
+	for {
+		req, _, err := c.ReadOp(OperationRequest)
+		if err != nil {
+			return err
+		}
+
+		// Replying to our own requests could create a loop
+		if c.IsLocalSender(req) {
+			continue
+		}
+
+		mac := fn(req.TargetIP)
+		if mac == nil {
+			continue
+		}
+
+		if err := c.Reply(req, mac, req.TargetIP); err != nil {
+			return err
+		}
+	}
+}
+
+// IsLocalSender reports whether p was sent from the hardware address of the
+// Client's network interface, or from the address set using SetSourceMAC.
+// Responders should not reply to such packets, which may be the Client's
+// own packets reflected back to it.
+func (c *Client) IsLocalSender(p *Packet) bool {
+	return bytes.Equal(p.SenderMAC, c.ifi.HardwareAddr) ||
+		bytes.Equal(p.SenderMAC, c.sourceMAC())
+}
+
+// LocallyAdministeredMAC returns a unique, locally administered unicast
+// ethernet hardware address derived from the IPv4 address ip: the address
+// 02:00 followed by the four octets of ip. If ip is not an IPv4 address,
+// nil is returned.
+//
+// LocallyAdministeredMAC may be passed to RespondComputed to answer for
+// every address in a subnet.
+func LocallyAdministeredMAC(ip net.IP) net.HardwareAddr {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return nil
+	}
+
+	return net.HardwareAddr{0x02, 0x00, ip4[0], ip4[1], ip4[2], ip4[3]}
+}
+
+// Defend implements the defense half of RFC 5227 address conflict
+// detection for ips, using the hardware address of the Client's network
+// interface, or the address set using SetSourceMAC, as the owner of each
+// address.
+//
+// Defend reads ARP packets, and when it observes a conflict for one of ips,
+// it broadcasts an announcement to reassert ownership of that address. A
+// conflict is a packet which was not sent by the Client's host, as reported
+// by IsLocalSender, and which either uses the address as its sender IPv4
+// address, or is a probe for the address. To avoid an endless exchange with
+// a host which continues to claim the address, each address is defended at
+// most once per DefendInterval. Defend continues until an error occurs
+// while reading or writing, and returns that error.
+//
+// Packets read by Defend are not available to concurrent calls to Read.
+func (c *Client) Defend(ips ...net.IP) error {
+	mac := c.sourceMAC()
+	owned := func(ip net.IP) net.IP {
+		for _, o := range ips {
+			if o.Equal(ip) {
+				return o
+			}
+		}
+
+		return nil
+	}
+
+	last := make(map[string]time.Time)
+	for {
+		p, _, err := c.Read()
+		if err != nil {
+			return err
+		}
+
+		if c.IsLocalSender(p) {
+			continue
+		}
+
+		ip := owned(p.SenderIP)
+		if ip == nil && Classify(p) == KindProbe {
+			ip = owned(p.TargetIP)
+		}
+		if ip == nil {
+			continue
+		}
+
+		key := ip.String()
+		if t, ok := last[key]; ok && time.Since(t) < DefendInterval {
+			continue
+		}
+
+		a, err := NewAnnouncementPacket(mac, ip)
+		if err != nil {
+			return err
+		}
+		if err := c.WriteTo(a, ethernet.Broadcast); err != nil {
+			return err
+		}
+
+		last[key] = time.Now()
+	}
+}
+
+// SetReadBufferSize sets the size of the buffer used to read a single
+// ethernet frame. If n is zero or less, DefaultReadBufferSize is used.
+//
+// A frame which completely fills the buffer was likely truncated, so reads
+// of such a frame return io.ErrShortBuffer rather than decoding it.
+//
+// SetReadBufferSize does not affect the operating system's socket receive
+// buffer.
+func (c *Client) SetReadBufferSize(n int) {
+	c.smu.Lock()
+	defer c.smu.Unlock()
+
+	c.bufSize = n
+}
+
+// SetSourceMAC sets the hardware address used as the sender of ARP packets
+// generated by the Client, such as by Request, Respond, and Defend, in place
+// of the hardware address of the Client's network interface. If mac is nil,
+// the interface's hardware address is used again. If mac is not the same
+// length as the interface's hardware address, ErrInvalidMAC is returned.
+//
+// SetSourceMAC only changes the contents of packets generated by the
+// Client. It does not change the hardware address of the network interface
+// or the socket's binding, and packets passed to WriteTo are sent as-is.
+func (c *Client) SetSourceMAC(mac net.HardwareAddr) error {
+	if mac != nil && len(mac) != len(c.ifi.HardwareAddr) {
+		return ErrInvalidMAC
+	}
+
+	c.smu.Lock()
+	defer c.smu.Unlock()
+
+	if mac == nil {
+		c.srcMAC = nil
+		return nil
+	}
+
+	c.srcMAC = append(net.HardwareAddr(nil), mac...)
+	return nil
+}
+
+// sourceMAC returns the hardware address used as the sender of packets
+// generated by the Client
+func (c *Client) sourceMAC() net.HardwareAddr {
+	c.smu.RLock()
+	defer c.smu.RUnlock()
+
+	if c.srcMAC != nil {
+		return c.srcMAC
+	}
+
+	return c.ifi.HardwareAddr
+}
+
+// SetStrictValidation enables or disables strict validation of received
+// packets. When enabled, packets which fail Packet.ValidateStrict, such as
+// those with a multicast or broadcast sender hardware address, are
+// discarded by all methods which read packets. Strict validation is
+// disabled by default.
+func (c *Client) SetStrictValidation(enable bool) {
+	c.smu.Lock()
+	defer c.smu.Unlock()
+
+	c.strictValidation = enable
+}
+
+// strict reports whether strict validation of received packets is enabled
+func (c *Client) strict() bool {
+	c.smu.RLock()
+	defer c.smu.RUnlock()
+
+	return c.strictValidation
+}
+
+// SetAllowForeignMedium enables or disables writing packets whose
+// MACLength differs from the length of the network interface's hardware
+// address. By default, such packets are rejected by WriteTo and related
+// methods with an error wrapping ErrMACLengthMismatch, as they usually
+// indicate a construction mistake. Relays and bridges which intentionally
+// carry packets for another medium may enable this.
+func (c *Client) SetAllowForeignMedium(enable bool) {
+	c.smu.Lock()
+	defer c.smu.Unlock()
+
+	c.allowForeignMedium = enable
+}
+
+// etherType returns the EtherType of packets sent and received by the
+// Client
+func (c *Client) etherType() ethernet.EtherType {
+	if c.proto == 0 {
+		return ethernet.EtherTypeARP
+	}
+
+	return c.proto
+}
+
+// readBufferSize returns the configured read buffer size, or the default
+// if none is set
+func (c *Client) readBufferSize() int {
+	c.smu.RLock()
+	defer c.smu.RUnlock()
+
+	if c.bufSize <= 0 {
+		return DefaultReadBufferSize
+	}
+
+	return c.bufSize
+}
+
+// SetDeadline sets the read and write deadlines associated with the
+// connection
+func (c *Client) SetDeadline(t time.Time) error {
+	return c.setDeadline(t, c.p.SetDeadline, true)
+}
+
+// SetReadDeadline sets the deadline for future raw socket read calls
+func (c *Client) SetReadDeadline(t time.Time) error {
+	return c.setDeadline(t, c.p.SetReadDeadline, true)
+}
+
+// SetWriteDeadline sets the deadline for future raw socket write calls
+func (c *Client) SetWriteDeadline(t time.Time) error {
+	return c.setDeadline(t, c.p.SetWriteDeadline, false)
+}
+
+// setDeadline applies t using set, and records it for DeadlineContext if
+// successful. If read is true, t is also recorded as the read deadline.
+func (c *Client) setDeadline(t time.Time, set func(time.Time) error, read bool) error {
+	if err := set(t); err != nil {
+		return err
+	}
+
+	c.dmu.Lock()
+	defer c.dmu.Unlock()
+	c.deadline = t
+	if read {
+		c.readDeadline = t
+	}
+
+	return nil
+}
+
+// restoreReadDeadline applies the caller's read deadline, the one most
+// recently set using SetReadDeadline or SetDeadline, to the socket, undoing
+// any deadline set internally. The caller must hold the read lock.
+func (c *Client) restoreReadDeadline() error {
+	c.dmu.Lock()
+	d := c.readDeadline
+	c.dmu.Unlock()
+
+	return c.p.SetReadDeadline(d)
+}
+
+// DeadlineContext returns a context which expires at the deadline most
+// recently set using SetDeadline, SetReadDeadline, or SetWriteDeadline. If
+// no deadline is set, the context never expires, but is canceled when the
+// returned CancelFunc is called.
+//
+// Changing the Client's deadline after calling DeadlineContext does not
+// affect contexts which were already returned.
+func (c *Client) DeadlineContext() (context.Context, context.CancelFunc) {
+	c.dmu.Lock()
+	d := c.deadline
+	c.dmu.Unlock()
+
+	if d.IsZero() {
+		return context.WithCancel(context.Background())
+	}
+
+	return context.WithDeadline(context.Background(), d)
+}
+
+// Interface returns a copy of the network interface associated with the
+// connection.
+func (c *Client) Interface() *net.Interface {
+	ifi := *c.ifi
+	ifi.HardwareAddr = c.HardwareAddr()
+	return &ifi
+}
+
+// HardwareAddr fetches the hardware address for the interface associated
+// with the connection. The returned address is a copy, and may be modified
+// by the caller.
+func (c *Client) HardwareAddr() net.HardwareAddr {
+	return append(net.HardwareAddr(nil), c.ifi.HardwareAddr...)
+}
+
+// HasIPv4 reports whether the Client's network interface has an IPv4
+// address. A Client without an IPv4 address cannot send ARP requests.
+func (c *Client) HasIPv4() bool {
+	return c.ip != nil
+}
+
+// Warning returns a non-fatal problem with the Client's configuration
+// which callers may wish to report, or nil if there is none. If the
+// interface has IPv6 addresses but no IPv4 address, which is a common
+// mistake since ARP is IPv4-only, ErrIPv6Only is returned.
+func (c *Client) Warning() error {
+	if c.ipv6Only {
+		return ErrIPv6Only
+	}
+
+	return nil
+}
+
+// LocalIP returns a copy of the IPv4 address used by the Client as the
+// sender address for its ARP requests.
+func (c *Client) LocalIP() net.IP {
+	return append(net.IP(nil), c.ip...)
+}
+
+// Subnets returns a copy of the IPv4 subnets configured on the Client's
+// network interface, as retrieved when the Client was created or last
+// refreshed.
+func (c *Client) Subnets() []*net.IPNet {
+	subnets := make([]*net.IPNet, 0, len(c.subnets))
+	for _, n := range c.subnets {
+		subnets = append(subnets, &net.IPNet{
+			IP:   append(net.IP(nil), n.IP...),
+			Mask: append(net.IPMask(nil), n.Mask...),
+		})
+	}
+
+	return subnets
+}
+
+// OnLink determines if ip is within one of the IPv4 subnets configured on
+// the Client's network interface. Only on-link addresses can be resolved
+// using ARP.
+func (c *Client) OnLink(ip net.IP) bool {
+	for _, n := range c.subnets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ipv4Subnets retrieves all IPv4 subnets from an input slice of network
+// addresses. Addresses which cannot be parsed are skipped.
+func ipv4Subnets(addrs []net.Addr) []*net.IPNet {
+	var subnets []*net.IPNet
+	for _, a := range addrs {
+		if a.Network() != "ip+net" {
+			continue
+		}
+
+		ip, ipn, err := net.ParseCIDR(a.String())
+		if err != nil {
+			continue
+		}
+
+		if ip.To4() == nil {
+			continue
+		}
+
+		subnets = append(subnets, ipn)
+	}
+
+	return subnets
+}
+
+// ipv4Addrs retrieves all IPv4 addresses from an input slice of network
+// addresses. Addresses which cannot be parsed are skipped.
+func ipv4Addrs(addrs []net.Addr) []net.IP {
+	var ips []net.IP
+	for _, a := range addrs {
+		if a.Network() != "ip+net" {
+			continue
+		}
+
+		ip, _, err := net.ParseCIDR(a.String())
+		if err != nil {
+			continue
+		}
+
+		if ip4 := ip.To4(); ip4 != nil {
+			ips = append(ips, ip4)
+		}
+	}
+
+	return ips
+}
+
+// hasIPv6Addr determines if an input slice of network addresses contains an
+// IPv6 address
+func hasIPv6Addr(addrs []net.Addr) bool {
+	for _, a := range addrs {
+		if a.Network() != "ip+net" {
+			continue
+		}
+
+		ip, _, err := net.ParseCIDR(a.String())
+		if err != nil {
+			continue
+		}
+
+		if ip.To4() == nil {
+			return true
+		}
+	}
+
+	return false
 }
 
 // firstIPv4Addr attempts to retrieve the first detected IPv4 address from an
 // input slice of network addresses.
+//
+// Addresses which cannot be parsed are skipped, so a single malformed
+// address does not prevent use of the interface. If no IPv4 address is
+// found and an address could not be parsed, the first parse error is
+// returned, since the malformed address may have been the IPv4 address.
 func firstIPv4Addr(addrs []net.Addr) (net.IP, error) {
+	var perr error
 	for _, a := range addrs {
 		if a.Network() != "ip+net" {
 			continue
@@ -220,7 +2124,11 @@ func firstIPv4Addr(addrs []net.Addr) (net.IP, error) {
 
 		ip, _, err := net.ParseCIDR(a.String())
 		if err != nil {
-			return nil, err
+			if perr == nil {
+				perr = err
+			}
+
+			continue
 		}
 
 		// If ip is not an IPv4 address, To4 returns nil
@@ -229,5 +2137,5 @@ func firstIPv4Addr(addrs []net.Addr) (net.IP, error) {
 		}
 	}
 
-	return nil, nil
+	return nil, perr
 }
@@ -2,10 +2,18 @@ package arp
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"io"
 	"net"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/caser789/ethernet"
+	"github.com/caser789/raw"
 )
 
 func TestClientRequestNoIPv4Address(t *testing.T) {
@@ -18,6 +26,69 @@ func TestClientRequestNoIPv4Address(t *testing.T) {
 	}
 }
 
+func TestClientRequestNotOnLink(t *testing.T) {
+	c := &Client{
+		ifi: &net.Interface{
+			HardwareAddr: net.HardwareAddr{0, 0, 0, 0, 0, 0},
+		},
+		ip: net.IPv4(192, 168, 1, 1).To4(),
+		subnets: []*net.IPNet{{
+			IP:   net.IPv4(192, 168, 1, 0).To4(),
+			Mask: []byte{255, 255, 255, 0},
+		}},
+	}
+
+	got := c.Request(net.IPv4(10, 0, 0, 1))
+	if want := ErrNotOnLink; want != got {
+		t.Fatalf("unexpected error for address not on link:\n- want: %v\n- got: %v",
+			want, got)
+	}
+}
+
+func TestClientRequestVia(t *testing.T) {
+	gwMAC := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	gwIP := net.IPv4(192, 168, 1, 254)
+
+	p := &writeToCapturePacketConn{}
+	c := &Client{
+		ifi: &net.Interface{
+			HardwareAddr: net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+		},
+		ip: net.IPv4(192, 168, 1, 1).To4(),
+		p:  p,
+	}
+
+	if want, got := ErrInvalidMAC, c.RequestVia(gwIP, gwMAC[:4]); want != got {
+		t.Fatalf("unexpected error for short destination MAC: %v != %v", want, got)
+	}
+
+	if err := c.RequestVia(gwIP, gwMAC); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := gwMAC.String(), p.addr.(*raw.Addr).HardwareAddr.String(); want != got {
+		t.Fatalf("unexpected destination address: %v != %v", want, got)
+	}
+
+	req, f, err := parsePacket(p.b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := gwMAC, f.Destination; !bytes.Equal(want, got) {
+		t.Fatalf("unexpected ethernet destination: %v != %v", want, got)
+	}
+	if want, got := OperationRequest, req.Operation; want != got {
+		t.Fatalf("unexpected operation: %v != %v", want, got)
+	}
+	if want, got := gwMAC, req.TargetMAC; !bytes.Equal(want, got) {
+		t.Fatalf("unexpected target MAC: %v != %v", want, got)
+	}
+	if want, got := gwIP, req.TargetIP; !want.Equal(got) {
+		t.Fatalf("unexpected target IP: %v != %v", want, got)
+	}
+}
+
 func TestClientRequestInvalidSourceMAC(t *testing.T) {
 	c := &Client{
 		ifi: &net.Interface{},
@@ -42,12 +113,82 @@ func TestClientRequestIPv6Address(t *testing.T) {
 
 	_, got := c.Resolve(net.IPv6zero)
 
-	if want := ErrInvalidIP; want != got {
+	if want := ErrInvalidIP; !errors.Is(got, want) {
 		t.Fatalf("unexpected error for IPv6 address:\n- want: %v\n- got: %v",
 			want, got)
 	}
 }
 
+func TestClientRequestReplyInvalidIP(t *testing.T) {
+	mac := net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+	ip := net.IPv4(192, 168, 1, 1)
+
+	req, err := NewPacket(OperationRequest, mac, net.IPv4(192, 168, 1, 10), ethernet.Broadcast, ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ipv6Req := *req
+	ipv6Req.SenderIP = net.IPv6loopback
+
+	newInvalidClient := func(ip net.IP) *Client {
+		return &Client{
+			ifi: &net.Interface{
+				HardwareAddr: mac,
+			},
+			ip: ip,
+			p:  &noopPacketConn{},
+		}
+	}
+
+	var tests = []struct {
+		desc string
+		fn   func() error
+		arg  string
+	}{
+		{
+			desc: "request invalid target",
+			fn: func() error {
+				return newInvalidClient(ip.To4()).Request(net.IPv6loopback)
+			},
+			arg: "target IP",
+		},
+		{
+			desc: "request invalid sender",
+			fn: func() error {
+				return newInvalidClient(net.IPv6loopback).Request(ip)
+			},
+			arg: "sender IP",
+		},
+		{
+			desc: "reply invalid sender",
+			fn: func() error {
+				return newInvalidClient(ip.To4()).Reply(req, mac, net.IPv6loopback)
+			},
+			arg: "sender IP",
+		},
+		{
+			desc: "reply invalid target",
+			fn: func() error {
+				return newInvalidClient(ip.To4()).Reply(&ipv6Req, mac, ip)
+			},
+			arg: "target IP",
+		},
+	}
+
+	for i, tt := range tests {
+		err := tt.fn()
+		if !errors.Is(err, ErrInvalidIP) {
+			t.Fatalf("[%02d] test %q, unexpected error: %v",
+				i, tt.desc, err)
+		}
+		if !strings.HasPrefix(err.Error(), tt.arg+": ") {
+			t.Fatalf("[%02d] test %q, error does not name %s: %v",
+				i, tt.desc, tt.arg, err)
+		}
+	}
+}
+
 func TestClientRequestErrWriteTo(t *testing.T) {
 	errWriteTo := errors.New("test error")
 
@@ -103,7 +244,7 @@ func TestClientRequestEthernetFrameUnexpectedEOF(t *testing.T) {
 
 	_, got := c.Resolve(net.IPv4zero)
 
-	if want := io.ErrUnexpectedEOF; want != got {
+	if want := io.ErrUnexpectedEOF; !errors.Is(got, want) {
 		t.Fatalf("unexpected error while reading ethernet frame:\n- want: %v\n- got: %v",
 			want, got)
 	}
@@ -168,14 +309,14 @@ func TestClientRequestARPPacketUnexpectedEOF(t *testing.T) {
 				0x08, 0x06,
 				0, 0,
 				0, 0,
-				255, 255,
+				20, 16,
 			}, make([]byte, 40)...)),
 		},
 	}
 
 	_, got := c.Resolve(net.IPv4zero)
 
-	if want := io.ErrUnexpectedEOF; want != got {
+	if want := io.ErrUnexpectedEOF; !errors.Is(got, want) {
 		t.Fatalf("unexpected error wihle reading ARP packet:\n- want: %v\n- got: %v",
 			want, got)
 	}
@@ -280,6 +421,1946 @@ func TestClientRequestOK(t *testing.T) {
 	}
 }
 
+func TestClientResolveFull(t *testing.T) {
+	clientMAC := net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+	arpMAC := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	ethMAC := net.HardwareAddr{0x11, 0x22, 0x33, 0x44, 0x55, 0x66}
+
+	c := &Client{
+		ifi: &net.Interface{
+			HardwareAddr: clientMAC,
+		},
+		ip: net.IPv4(192, 168, 1, 1).To4(),
+		p: &bufferReadFromPacketConn{
+			b: bytes.NewBuffer(append([]byte{
+				0xde, 0xad, 0xbe, 0xef, 0xde, 0xad,
+				0x11, 0x22, 0x33, 0x44, 0x55, 0x66,
+				0x08, 0x06,
+				0, 1,
+				0x08, 0x00,
+				6, 4,
+				0, 2,
+				0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff,
+				192, 168, 1, 10,
+				0xde, 0xad, 0xbe, 0xef, 0xde, 0xad,
+				192, 168, 1, 1,
+			}, make([]byte, 18)...)),
+		},
+	}
+
+	p, f, err := c.ResolveFull(net.IPv4(192, 168, 1, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := arpMAC, p.SenderMAC; !bytes.Equal(want, got) {
+		t.Fatalf("unexpected ARP sender MAC:\n- want: %v\n- got: %v", want, got)
+	}
+	if want, got := ethMAC, f.Source; !bytes.Equal(want, got) {
+		t.Fatalf("unexpected ethernet source MAC:\n- want: %v\n- got: %v", want, got)
+	}
+}
+
+func TestClientResolveHost(t *testing.T) {
+	subnets := []*net.IPNet{{
+		IP:   net.IPv4(192, 168, 1, 0).To4(),
+		Mask: []byte{255, 255, 255, 0},
+	}}
+
+	var tests = []struct {
+		desc string
+		host string
+		mac  net.HardwareAddr
+		err  error
+	}{
+		{
+			desc: "IPv6 address",
+			host: "::1",
+			err:  ErrNoIPv4Host,
+		},
+		{
+			desc: "IPv4 address not on link",
+			host: "10.0.0.1",
+			err:  ErrNotOnLink,
+		},
+		{
+			desc: "OK",
+			host: "192.168.1.10",
+			mac:  net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff},
+		},
+	}
+
+	for i, tt := range tests {
+		c := &Client{
+			ifi: &net.Interface{
+				HardwareAddr: net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+			},
+			ip:      net.IPv4(192, 168, 1, 1).To4(),
+			subnets: subnets,
+			p: &bufferReadFromPacketConn{
+				b: bytes.NewBuffer(append([]byte{
+					0xde, 0xad, 0xbe, 0xef, 0xde, 0xad,
+					0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff,
+					0x08, 0x06,
+					0, 1,
+					0x08, 0x00,
+					6, 4,
+					0, 2,
+					0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff,
+					192, 168, 1, 10,
+					0xde, 0xad, 0xbe, 0xef, 0xde, 0xad,
+					192, 168, 1, 1,
+				}, make([]byte, 18)...)),
+			},
+		}
+
+		mac, err := c.ResolveHost(tt.host)
+		if err != nil {
+			if want, got := tt.err, err; want != got {
+				t.Fatalf("[%02d] test %q, unexpected error: %v != %v",
+					i, tt.desc, want, got)
+			}
+
+			continue
+		}
+
+		if want, got := tt.mac, mac; !bytes.Equal(want, got) {
+			t.Fatalf("[%02d] test %q, unexpected MAC address: %v != %v",
+				i, tt.desc, want, got)
+		}
+	}
+}
+
+func TestClientRequestAndCollect(t *testing.T) {
+	clientMAC := net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+	clientIP := net.IPv4(192, 168, 1, 1)
+	ip := net.IPv4(192, 168, 1, 10)
+
+	mac1 := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x01}
+	mac2 := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x02}
+	mac3 := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x03}
+
+	frames := [][]byte{
+		mustARPFrame(t, OperationReply, mac1, ip, clientMAC, clientIP),
+		mustARPFrame(t, OperationReply, mac2, net.IPv4(192, 168, 1, 20), clientMAC, clientIP),
+		mustARPFrame(t, OperationReply, mac2, ip, clientMAC, clientIP),
+		mustARPFrame(t, OperationReply, mac3, ip, clientMAC, clientIP),
+	}
+
+	var tests = []struct {
+		desc string
+		n    int
+		macs []net.HardwareAddr
+	}{
+		{
+			desc: "stop after n replies",
+			n:    2,
+			macs: []net.HardwareAddr{mac1, mac2},
+		},
+		{
+			desc: "all replies until timeout",
+			macs: []net.HardwareAddr{mac1, mac2, mac3},
+		},
+		{
+			desc: "fewer than n replies before timeout",
+			n:    5,
+			macs: []net.HardwareAddr{mac1, mac2, mac3},
+		},
+	}
+
+	for i, tt := range tests {
+		c := &Client{
+			ifi: &net.Interface{
+				HardwareAddr: clientMAC,
+			},
+			ip: clientIP.To4(),
+			p: &frameReadFromPacketConn{
+				frames: frames,
+				err:    &timeoutError{},
+			},
+		}
+
+		ps, err := c.RequestAndCollect(ip, tt.n, time.Second)
+		if err != nil {
+			t.Fatalf("[%02d] test %q, unexpected error: %v", i, tt.desc, err)
+		}
+
+		if want, got := len(tt.macs), len(ps); want != got {
+			t.Fatalf("[%02d] test %q, unexpected number of replies: %v != %v",
+				i, tt.desc, want, got)
+		}
+		for j := range ps {
+			if want, got := tt.macs[j], ps[j].SenderMAC; !bytes.Equal(want, got) {
+				t.Fatalf("[%02d] test %q, unexpected MAC for reply %d: %v != %v",
+					i, tt.desc, j, want, got)
+			}
+		}
+	}
+}
+
+func TestClientReadOp(t *testing.T) {
+	reply := append([]byte{
+		0xde, 0xad, 0xbe, 0xef, 0xde, 0xad,
+		0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff,
+		0x08, 0x06,
+		0, 1,
+		0x08, 0x00,
+		6, 4,
+		0, 2,
+		0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff,
+		192, 168, 1, 10,
+		0xde, 0xad, 0xbe, 0xef, 0xde, 0xad,
+		192, 168, 1, 1,
+	}, make([]byte, 18)...)
+
+	request := append([]byte{
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+		0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff,
+		0x08, 0x06,
+		0, 1,
+		0x08, 0x00,
+		6, 4,
+		0, 1,
+		0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff,
+		192, 168, 1, 10,
+		0, 0, 0, 0, 0, 0,
+		192, 168, 1, 1,
+	}, make([]byte, 18)...)
+
+	var tests = []struct {
+		desc string
+		op   Operation
+		want Operation
+	}{
+		{
+			desc: "any operation",
+			want: OperationReply,
+		},
+		{
+			desc: "replies only",
+			op:   OperationReply,
+			want: OperationReply,
+		},
+		{
+			desc: "requests only",
+			op:   OperationRequest,
+			want: OperationRequest,
+		},
+	}
+
+	for i, tt := range tests {
+		c := &Client{
+			p: &frameReadFromPacketConn{
+				frames: [][]byte{reply, request},
+			},
+		}
+
+		p, _, err := c.ReadOp(tt.op)
+		if err != nil {
+			t.Fatalf("[%02d] test %q, unexpected error: %v", i, tt.desc, err)
+		}
+
+		if want, got := tt.want, p.Operation; want != got {
+			t.Fatalf("[%02d] test %q, unexpected operation: %v != %v",
+				i, tt.desc, want, got)
+		}
+	}
+}
+
+func TestClientReadBufferSize(t *testing.T) {
+	iboip1 := net.HardwareAddr(bytes.Repeat([]byte{1}, 20))
+	iboip2 := net.HardwareAddr(bytes.Repeat([]byte{2}, 20))
+
+	p, err := NewPacket(OperationReply, iboip1, net.IPv4(192, 168, 1, 10), iboip2, net.IPv4(192, 168, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pb, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 14 byte ethernet header, 56 byte ARP packet
+	frame := append([]byte{
+		0xde, 0xad, 0xbe, 0xef, 0xde, 0xad,
+		0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff,
+		0x08, 0x06,
+	}, pb...)
+
+	var tests = []struct {
+		desc string
+		size int
+		err  error
+	}{
+		{
+			desc: "buffer too small",
+			size: 64,
+			err:  io.ErrShortBuffer,
+		},
+		{
+			desc: "buffer exactly filled",
+			size: len(frame),
+			err:  io.ErrShortBuffer,
+		},
+		{
+			desc: "buffer sized for packet",
+			size: len(frame) + 1,
+		},
+		{
+			desc: "default buffer size",
+		},
+	}
+
+	for i, tt := range tests {
+		c := &Client{
+			p: &frameReadFromPacketConn{
+				frames: [][]byte{frame},
+			},
+		}
+		c.SetReadBufferSize(tt.size)
+
+		got, _, err := c.Read()
+		if err != nil {
+			if want := tt.err; want != err {
+				t.Fatalf("[%02d] test %q, unexpected error: %v != %v",
+					i, tt.desc, want, err)
+			}
+
+			continue
+		}
+
+		if want := iboip1; !bytes.Equal(want, got.SenderMAC) {
+			t.Fatalf("[%02d] test %q, unexpected sender MAC: %v != %v",
+				i, tt.desc, want, got.SenderMAC)
+		}
+	}
+}
+
+func TestClientReadStrict(t *testing.T) {
+	ipv4 := append([]byte{
+		0xde, 0xad, 0xbe, 0xef, 0xde, 0xad,
+		0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff,
+		0x08, 0x00,
+	}, make([]byte, 46)...)
+
+	arp := mustARPFrame(t, OperationRequest,
+		net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}, net.IPv4(192, 168, 1, 10),
+		ethernet.Broadcast, net.IPv4(192, 168, 1, 1))
+
+	c := &Client{
+		p: &frameReadFromPacketConn{
+			frames: [][]byte{ipv4, arp},
+		},
+	}
+
+	_, f, err := c.ReadStrict()
+	nerr, ok := err.(*NotARPError)
+	if !ok {
+		t.Fatalf("unexpected error for non-ARP frame: %v", err)
+	}
+	if want, got := ethernet.EtherTypeIPv4, nerr.Frame.EtherType; want != got {
+		t.Fatalf("unexpected EtherType: %v != %v", want, got)
+	}
+	if nerr.Frame != f {
+		t.Fatal("non-ARP frame was not returned")
+	}
+
+	p, _, err := c.ReadStrict()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := OperationRequest, p.Operation; want != got {
+		t.Fatalf("unexpected operation: %v != %v", want, got)
+	}
+}
+
+func TestClientProtocolRARP(t *testing.T) {
+	mac := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	arp := mustARPFrame(t, OperationRequest, mac, net.IPv4(192, 168, 1, 10),
+		ethernet.Broadcast, net.IPv4(192, 168, 1, 1))
+
+	// Same packet, carried in a RARP frame
+	rarp := append([]byte(nil), arp...)
+	rarp[12], rarp[13] = 0x80, 0x35
+
+	p := &frameReadWriteCapturePacketConn{
+		frameReadFromPacketConn: frameReadFromPacketConn{
+			frames: [][]byte{arp, rarp},
+		},
+	}
+	c := &Client{
+		ifi: &net.Interface{
+			HardwareAddr: mac,
+		},
+		p:     p,
+		proto: EtherTypeRARP,
+	}
+
+	_, f, err := c.ReadStrict()
+	if _, ok := err.(*NotARPError); !ok {
+		t.Fatalf("expected ARP frame to be rejected, got error: %v", err)
+	}
+	if want, got := ethernet.EtherTypeARP, f.EtherType; want != got {
+		t.Fatalf("unexpected EtherType: %v != %v", want, got)
+	}
+
+	if _, _, err := c.Read(); err != nil {
+		t.Fatalf("unexpected error reading RARP frame: %v", err)
+	}
+
+	pkt, err := NewPacket(OperationRequest, mac, net.IPv4(192, 168, 1, 10), ethernet.Broadcast, net.IPv4(192, 168, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WriteTo(pkt, ethernet.Broadcast); err != nil {
+		t.Fatal(err)
+	}
+
+	wf := new(ethernet.Frame)
+	if err := wf.UnmarshalBinary(p.writes[0]); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := EtherTypeRARP, wf.EtherType; want != got {
+		t.Fatalf("unexpected EtherType for written frame: %v != %v", want, got)
+	}
+}
+
+func TestClientReadInfo(t *testing.T) {
+	srcMAC := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	frame := append([]byte{
+		0xde, 0xad, 0xbe, 0xef, 0xde, 0xad,
+		0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff,
+		0x81, 0x00,
+		0x00, 0x0a,
+		0x08, 0x06,
+		0, 1,
+		0x08, 0x00,
+		6, 4,
+		0, 2,
+		0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff,
+		192, 168, 1, 10,
+		0xde, 0xad, 0xbe, 0xef, 0xde, 0xad,
+		192, 168, 1, 1,
+	}, make([]byte, 14)...)
+
+	c := &Client{
+		p: &frameReadFromPacketConn{
+			frames: [][]byte{frame},
+		},
+	}
+
+	before := time.Now()
+	p, info, err := c.ReadInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := OperationReply, p.Operation; want != got {
+		t.Fatalf("unexpected operation: %v != %v", want, got)
+	}
+	if want, got := uint16(10), info.VLAN; want != got {
+		t.Fatalf("unexpected VLAN ID: %v != %v", want, got)
+	}
+	if want, got := len(frame), info.FrameLen; want != got {
+		t.Fatalf("unexpected frame length: %v != %v", want, got)
+	}
+	if want, got := srcMAC, info.Source; !bytes.Equal(want, got) {
+		t.Fatalf("unexpected source address: %v != %v", want, got)
+	}
+	if info.Timestamp.Before(before) {
+		t.Fatalf("timestamp %v is before read began at %v", info.Timestamp, before)
+	}
+}
+
+func TestClientRequestID(t *testing.T) {
+	clientMAC := net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+	clientIP := net.IPv4(192, 168, 1, 1)
+	peerMAC := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	ipA := net.IPv4(192, 168, 1, 10)
+	ipB := net.IPv4(192, 168, 1, 20)
+
+	p := &frameReadFromPacketConn{}
+	c := &Client{
+		ifi: &net.Interface{
+			HardwareAddr: clientMAC,
+		},
+		ip: clientIP.To4(),
+		p:  p,
+	}
+
+	idA, err := c.RequestID(ipA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idB, err := c.RequestID(ipB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if idA == 0 || idB <= idA {
+		t.Fatalf("request IDs are not monotonically increasing: %v, %v", idA, idB)
+	}
+
+	// Replies arrive out of order, and an unrequested reply is not
+	// annotated
+	p.frames = [][]byte{
+		mustARPFrame(t, OperationReply, peerMAC, ipB, clientMAC, clientIP),
+		mustARPFrame(t, OperationReply, peerMAC, net.IPv4(192, 168, 1, 30), clientMAC, clientIP),
+		mustARPFrame(t, OperationReply, peerMAC, ipA, clientMAC, clientIP),
+	}
+
+	for i, want := range []uint64{idB, 0, idA} {
+		_, info, err := c.ReadInfo()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := info.RequestID; want != got {
+			t.Fatalf("[%02d] unexpected request ID: %v != %v", i, want, got)
+		}
+	}
+}
+
+func TestClientRequestIDWriteError(t *testing.T) {
+	ip := net.IPv4(192, 168, 1, 10)
+
+	p := &errWriteToPacketConn{}
+	c := &Client{
+		ifi: &net.Interface{
+			HardwareAddr: net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+		},
+		ip: net.IPv4(192, 168, 1, 1).To4(),
+		p:  p,
+	}
+
+	// A request which cannot be sent is not recorded
+	errWriteTo := errors.New("test error")
+	p.err = errWriteTo
+	if _, err := c.RequestID(ip); err != errWriteTo {
+		t.Fatalf("unexpected error: %v != %v", errWriteTo, err)
+	}
+	if want, got := 0, len(c.ids); want != got {
+		t.Fatalf("unexpected number of outstanding requests: %v != %v", want, got)
+	}
+
+	// A failed retry leaves the earlier outstanding request in place
+	p.err = nil
+	id, err := c.RequestID(ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.err = errWriteTo
+	if _, err := c.RequestID(ip); err != errWriteTo {
+		t.Fatalf("unexpected error: %v != %v", errWriteTo, err)
+	}
+	if want, got := id, c.ids[ip.String()].id; want != got {
+		t.Fatalf("unexpected outstanding request ID: %v != %v", want, got)
+	}
+}
+
+func TestClientReadRaw(t *testing.T) {
+	mac := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	frame := mustARPFrame(t, OperationRequest, mac, net.IPv4(192, 168, 1, 10),
+		ethernet.Broadcast, net.IPv4(192, 168, 1, 1))
+
+	// Trailing padding is not preserved by decoding and re-encoding the
+	// frame, but must be present in the raw bytes
+	frame = append(frame, 0xff, 0xff)
+
+	c := &Client{
+		p: &frameReadFromPacketConn{
+			frames: [][]byte{frame},
+		},
+	}
+
+	p, _, b, err := c.ReadRaw()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := frame, b; !bytes.Equal(want, got) {
+		t.Fatalf("unexpected raw bytes:\n- want: %v\n-  got: %v", want, got)
+	}
+
+	// The raw bytes must not alias the decoded packet
+	b[14+8] = 0x00
+	if want, got := mac, p.SenderMAC; !bytes.Equal(want, got) {
+		t.Fatalf("decoded packet modified through raw bytes: %v != %v", want, got)
+	}
+}
+
+func TestClientStrictValidation(t *testing.T) {
+	spoofed := mustARPFrame(t, OperationReply, ethernet.Broadcast, net.IPv4(192, 168, 1, 10),
+		ethernet.Broadcast, net.IPv4(192, 168, 1, 1))
+	valid := mustARPFrame(t, OperationReply, net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff},
+		net.IPv4(192, 168, 1, 11), ethernet.Broadcast, net.IPv4(192, 168, 1, 1))
+
+	var tests = []struct {
+		desc   string
+		strict bool
+		ip     net.IP
+	}{
+		{
+			desc: "lenient",
+			ip:   net.IPv4(192, 168, 1, 10),
+		},
+		{
+			desc:   "strict",
+			strict: true,
+			ip:     net.IPv4(192, 168, 1, 11),
+		},
+	}
+
+	for i, tt := range tests {
+		c := &Client{
+			p: &frameReadFromPacketConn{
+				frames: [][]byte{spoofed, valid},
+			},
+		}
+		c.SetStrictValidation(tt.strict)
+
+		p, _, err := c.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want, got := tt.ip, p.SenderIP; !want.Equal(got) {
+			t.Fatalf("[%02d] test %q, unexpected sender IP: %v != %v",
+				i, tt.desc, want, got)
+		}
+	}
+}
+
+func TestClientRestoresReadDeadline(t *testing.T) {
+	ip := net.IPv4(192, 168, 1, 10)
+	peerMAC := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+
+	var tests = []struct {
+		desc string
+		fn   func(c *Client)
+	}{
+		{
+			desc: "IsReachable",
+			fn:   func(c *Client) { _, _ = c.IsReachable(ip, time.Second) },
+		},
+		{
+			desc: "ResolveTimeout",
+			fn:   func(c *Client) { _, _ = c.ResolveTimeout(ip, time.Second) },
+		},
+		{
+			desc: "ResolveTrusted",
+			fn:   func(c *Client) { _, _ = c.ResolveTrusted(ip, nil, time.Second) },
+		},
+		{
+			desc: "ResolveRetryDirected",
+			fn:   func(c *Client) { _, _ = c.ResolveRetryDirected(ip, peerMAC, time.Second, 2) },
+		},
+		{
+			desc: "ResolveDetectConflict",
+			fn:   func(c *Client) { _, _, _ = c.ResolveDetectConflict(ip, time.Second) },
+		},
+		{
+			desc: "RequestAndCollect",
+			fn:   func(c *Client) { _, _ = c.RequestAndCollect(ip, 0, time.Second) },
+		},
+		{
+			desc: "Scan",
+			fn:   func(c *Client) { _, _ = c.Scan([]net.IP{ip}, time.Second) },
+		},
+		{
+			desc: "Flush",
+			fn:   func(c *Client) { _ = c.Flush() },
+		},
+	}
+
+	for i, tt := range tests {
+		p := &deadlineFrameReadFromPacketConn{
+			frameReadFromPacketConn: frameReadFromPacketConn{
+				err: &timeoutError{},
+			},
+		}
+		c := &Client{
+			ifi: &net.Interface{
+				HardwareAddr: net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+			},
+			ip: net.IPv4(192, 168, 1, 1).To4(),
+			p:  p,
+		}
+
+		d := time.Now().Add(time.Hour)
+		if err := c.SetReadDeadline(d); err != nil {
+			t.Fatal(err)
+		}
+
+		tt.fn(c)
+
+		if want, got := d, p.deadline; !want.Equal(got) {
+			t.Fatalf("[%02d] test %q, caller's read deadline was not restored: %v != %v",
+				i, tt.desc, want, got)
+		}
+	}
+}
+
+func TestClientFlush(t *testing.T) {
+	mac := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	frame := mustARPFrame(t, OperationRequest, mac, net.IPv4(192, 168, 1, 10),
+		ethernet.Broadcast, net.IPv4(192, 168, 1, 1))
+
+	p := &deadlineFrameReadFromPacketConn{
+		frameReadFromPacketConn: frameReadFromPacketConn{
+			frames: [][]byte{frame, frame, frame},
+			err:    &timeoutError{},
+		},
+	}
+	c := &Client{p: p}
+
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := 0, len(p.frames); want != got {
+		t.Fatalf("unexpected number of frames left queued: %v != %v", want, got)
+	}
+	if !p.deadline.IsZero() {
+		t.Fatalf("read deadline was not cleared: %v", p.deadline)
+	}
+
+	// Errors other than timeouts are returned
+	p.err = io.ErrUnexpectedEOF
+	if want, got := io.ErrUnexpectedEOF, c.Flush(); want != got {
+		t.Fatalf("unexpected error: %v != %v", want, got)
+	}
+}
+
+func TestClientResolveFunc(t *testing.T) {
+	mac := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	ip := net.IPv4(192, 168, 1, 10)
+
+	c := &Client{
+		ifi: &net.Interface{
+			HardwareAddr: net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+		},
+		ip: net.IPv4(192, 168, 1, 1).To4(),
+		p: &frameReadFromPacketConn{
+			frames: [][]byte{
+				// The responder announces itself using a gratuitous
+				// request, rather than a reply
+				mustARPFrame(t, OperationRequest, mac, ip, ethernet.Broadcast, ip),
+			},
+		},
+	}
+
+	got, err := c.ResolveFunc(ip, func(p *Packet) bool {
+		return p.SenderIP.Equal(ip)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := mac; !bytes.Equal(want, got) {
+		t.Fatalf("unexpected MAC address: %v != %v", want, got)
+	}
+}
+
+func TestClientResolveDetectConflict(t *testing.T) {
+	macA := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x01}
+	macB := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x02}
+	clientMAC := net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+	clientIP := net.IPv4(192, 168, 1, 1)
+	ip := net.IPv4(192, 168, 1, 10)
+
+	newConflictClient := func(frames ...[]byte) *Client {
+		return &Client{
+			ifi: &net.Interface{
+				HardwareAddr: clientMAC,
+			},
+			ip: clientIP.To4(),
+			p: &frameReadWriteCapturePacketConn{
+				frameReadFromPacketConn: frameReadFromPacketConn{
+					frames: frames,
+					err:    &timeoutError{},
+				},
+			},
+		}
+	}
+
+	replyA := mustARPFrame(t, OperationReply, macA, ip, clientMAC, clientIP)
+	replyB := mustARPFrame(t, OperationReply, macB, ip, clientMAC, clientIP)
+	unrelated := mustARPFrame(t, OperationReply, macB, net.IPv4(192, 168, 1, 11), clientMAC, clientIP)
+
+	c := newConflictClient(replyA, unrelated, replyB, replyA, replyB)
+	primary, others, err := c.ResolveDetectConflict(ip, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := macA, primary; !bytes.Equal(want, got) {
+		t.Fatalf("unexpected primary MAC: %v != %v", want, got)
+	}
+	if want, got := []net.HardwareAddr{macB}, others; !reflect.DeepEqual(want, got) {
+		t.Fatalf("unexpected conflicting MACs: %v != %v", want, got)
+	}
+
+	// A single responder produces no conflicts
+	c = newConflictClient(replyA, replyA)
+	if _, others, err := c.ResolveDetectConflict(ip, time.Second); err != nil || len(others) != 0 {
+		t.Fatalf("unexpected conflicts for single responder: %v, %v", others, err)
+	}
+
+	// No responder returns the timeout error
+	c = newConflictClient(unrelated)
+	_, _, err = c.ResolveDetectConflict(ip, time.Second)
+	if nerr, ok := err.(net.Error); !ok || !nerr.Timeout() {
+		t.Fatalf("expected timeout error, got: %v", err)
+	}
+}
+
+func TestClientResolveWithMeta(t *testing.T) {
+	clientMAC := net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+	clientIP := net.IPv4(192, 168, 1, 1)
+	peerMAC := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	ip := net.IPv4(192, 168, 1, 10)
+
+	c := &Client{
+		ifi: &net.Interface{
+			HardwareAddr: clientMAC,
+		},
+		ip: clientIP.To4(),
+		p: &frameReadWriteCapturePacketConn{
+			frameReadFromPacketConn: frameReadFromPacketConn{
+				frames: [][]byte{
+					mustARPFrame(t, OperationRequest, peerMAC, ip, ethernet.Broadcast, clientIP),
+					mustARPFrame(t, OperationReply, peerMAC, net.IPv4(192, 168, 1, 11), clientMAC, clientIP),
+					mustARPFrame(t, OperationReply, peerMAC, ip, clientMAC, clientIP),
+				},
+			},
+		},
+	}
+
+	mac, meta, err := c.ResolveWithMeta(ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := peerMAC, mac; !bytes.Equal(want, got) {
+		t.Fatalf("unexpected MAC address: %v != %v", want, got)
+	}
+	if want, got := 2, meta.Skipped; want != got {
+		t.Fatalf("unexpected number of skipped packets: %v != %v", want, got)
+	}
+	if meta.RTT < 0 {
+		t.Fatalf("unexpected negative RTT: %v", meta.RTT)
+	}
+
+	// Errors return no metadata
+	_, meta, err = c.ResolveWithMeta(ip)
+	if want, got := io.EOF, err; want != got {
+		t.Fatalf("unexpected error: %v != %v", want, got)
+	}
+	if want, got := (ResolveMeta{}), meta; want != got {
+		t.Fatalf("unexpected metadata for error: %v != %v", want, got)
+	}
+
+	// Time spent waiting for another reader is not part of the RTT
+	c.p = &frameReadWriteCapturePacketConn{
+		frameReadFromPacketConn: frameReadFromPacketConn{
+			frames: [][]byte{
+				mustARPFrame(t, OperationReply, peerMAC, ip, clientMAC, clientIP),
+			},
+		},
+	}
+
+	const wait = 50 * time.Millisecond
+	c.rmu.Lock()
+	metaC := make(chan ResolveMeta, 1)
+	go func() {
+		_, meta, err := c.ResolveWithMeta(ip)
+		if err != nil {
+			t.Error(err)
+		}
+		metaC <- meta
+	}()
+	time.Sleep(wait)
+	c.rmu.Unlock()
+
+	if meta := <-metaC; meta.RTT >= wait {
+		t.Fatalf("RTT includes time waiting for the read lock: %v", meta.RTT)
+	}
+}
+
+func TestClientResolveRetryDirected(t *testing.T) {
+	clientMAC := net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+	clientIP := net.IPv4(192, 168, 1, 1)
+	peerMAC := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	ip := net.IPv4(192, 168, 1, 10)
+
+	// Only the second, directed attempt is answered
+	p := &attemptReplyPacketConn{
+		attempt: 2,
+		reply:   mustARPFrame(t, OperationReply, peerMAC, ip, clientMAC, clientIP),
+	}
+	c := &Client{
+		ifi: &net.Interface{
+			HardwareAddr: clientMAC,
+		},
+		ip: clientIP.To4(),
+		p:  p,
+	}
+
+	if _, err := c.ResolveRetryDirected(ip, peerMAC[:4], time.Second, 3); err != ErrInvalidMAC {
+		t.Fatalf("unexpected error for invalid fallback MAC: %v", err)
+	}
+
+	mac, err := c.ResolveRetryDirected(ip, peerMAC, time.Second, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := peerMAC, mac; !bytes.Equal(want, got) {
+		t.Fatalf("unexpected MAC address: %v != %v", want, got)
+	}
+	if want, got := 2, len(p.writes); want != got {
+		t.Fatalf("unexpected number of attempts: %v != %v", want, got)
+	}
+
+	for i, want := range []net.HardwareAddr{ethernet.Broadcast, peerMAC} {
+		req, f, err := parsePacket(p.writes[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := f.Destination; !bytes.Equal(want, got) {
+			t.Fatalf("[%02d] unexpected ethernet destination: %v != %v", i, want, got)
+		}
+		if got := req.TargetMAC; !bytes.Equal(want, got) {
+			t.Fatalf("[%02d] unexpected target MAC: %v != %v", i, want, got)
+		}
+	}
+
+	// No reply to any attempt
+	p = &attemptReplyPacketConn{}
+	c.p = p
+	if _, err := c.ResolveRetryDirected(ip, peerMAC, time.Second, 2); err != ErrResolveTimeout {
+		t.Fatalf("unexpected error for no reply: %v", err)
+	}
+	if want, got := 2, len(p.writes); want != got {
+		t.Fatalf("unexpected number of attempts: %v != %v", want, got)
+	}
+}
+
+func TestClientResolveAsync(t *testing.T) {
+	clientMAC := net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+	clientIP := net.IPv4(192, 168, 1, 1)
+	peerMAC := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	ip := net.IPv4(192, 168, 1, 10)
+
+	newAsyncClient := func(p net.PacketConn) *Client {
+		return &Client{
+			ifi: &net.Interface{
+				HardwareAddr: clientMAC,
+			},
+			ip: clientIP.To4(),
+			p:  p,
+		}
+	}
+
+	// Resolution completes normally
+	p := newChanReadFromPacketConn()
+	p.frames <- mustARPFrame(t, OperationReply, peerMAC, ip, clientMAC, clientIP)
+
+	results, cancel := newAsyncClient(p).ResolveAsync(ip)
+	res := <-results
+	cancel()
+
+	if res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	if want, got := peerMAC, res.MAC; !bytes.Equal(want, got) {
+		t.Fatalf("unexpected MAC address: %v != %v", want, got)
+	}
+
+	// Resolution is canceled while blocked reading
+	p = newChanReadFromPacketConn()
+	c := newAsyncClient(p)
+
+	d := time.Now().Add(time.Hour)
+	if err := c.SetReadDeadline(d); err != nil {
+		t.Fatal(err)
+	}
+
+	results, cancel = c.ResolveAsync(ip)
+	<-p.reads
+	cancel()
+
+	// cancel waits for the background goroutine to exit, so the result
+	// must already be available
+	select {
+	case res := <-results:
+		if want, got := context.Canceled, res.Err; want != got {
+			t.Fatalf("unexpected error for canceled resolve: %v != %v", want, got)
+		}
+	default:
+		t.Fatal("no result delivered after cancel")
+	}
+
+	// The caller's read deadline is restored
+	if want, got := d, p.deadline; !want.Equal(got) {
+		t.Fatalf("unexpected read deadline after cancel: %v != %v", want, got)
+	}
+
+	// Canceling again is a no-op
+	cancel()
+}
+
+func TestClientResolveAsyncCancelConcurrentRead(t *testing.T) {
+	clientMAC := net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+	clientIP := net.IPv4(192, 168, 1, 1)
+	peerMAC := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	ip := net.IPv4(192, 168, 1, 10)
+
+	p := newChanReadFromPacketConn()
+	c := &Client{
+		ifi: &net.Interface{
+			HardwareAddr: clientMAC,
+		},
+		ip: clientIP.To4(),
+		p:  p,
+	}
+
+	// Another reader holds the read side of the Client
+	type readResult struct {
+		p   *Packet
+		err error
+	}
+	readC := make(chan readResult, 1)
+	go func() {
+		arp, _, err := c.Read()
+		readC <- readResult{p: arp, err: err}
+	}()
+	<-p.reads
+
+	// Canceling a resolution which is waiting for the reader must not
+	// interrupt that reader
+	results, cancel := c.ResolveAsync(ip)
+	cancel()
+
+	p.frames <- mustARPFrame(t, OperationRequest, peerMAC, ip, ethernet.Broadcast, clientIP)
+
+	res := <-readC
+	if res.err != nil {
+		t.Fatalf("concurrent read was interrupted: %v", res.err)
+	}
+	if want, got := ip, res.p.SenderIP; !want.Equal(got) {
+		t.Fatalf("unexpected sender IP: %v != %v", want, got)
+	}
+
+	if want, got := context.Canceled, (<-results).Err; want != got {
+		t.Fatalf("unexpected error for canceled resolve: %v != %v", want, got)
+	}
+}
+
+func TestClientRequestStreamStopConcurrentRead(t *testing.T) {
+	clientMAC := net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+	clientIP := net.IPv4(192, 168, 1, 1)
+	peerMAC := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	ip := net.IPv4(192, 168, 1, 10)
+
+	p := newChanReadFromPacketConn()
+	c := &Client{
+		ifi: &net.Interface{
+			HardwareAddr: clientMAC,
+		},
+		ip: clientIP.To4(),
+		p:  p,
+	}
+
+	// Another reader holds the read side of the Client
+	type readResult struct {
+		p   *Packet
+		err error
+	}
+	readC := make(chan readResult, 1)
+	go func() {
+		arp, _, err := c.Read()
+		readC <- readResult{p: arp, err: err}
+	}()
+	<-p.reads
+
+	// Stopping a stream which is waiting for the reader must not
+	// interrupt that reader
+	_, stop := c.RequestStream([]net.IP{ip})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		stop()
+	}()
+
+	select {
+	case res := <-readC:
+		t.Fatalf("concurrent read was interrupted: %v", res.err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	p.frames <- mustARPFrame(t, OperationRequest, peerMAC, ip, ethernet.Broadcast, clientIP)
+
+	res := <-readC
+	if res.err != nil {
+		t.Fatalf("concurrent read was interrupted: %v", res.err)
+	}
+	if want, got := ip, res.p.SenderIP; !want.Equal(got) {
+		t.Fatalf("unexpected sender IP: %v != %v", want, got)
+	}
+
+	<-stopped
+}
+
+func TestClientRequestStreamStopRestoresDeadline(t *testing.T) {
+	p := newChanReadFromPacketConn()
+	c := &Client{
+		ifi: &net.Interface{
+			HardwareAddr: net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+		},
+		ip: net.IPv4(192, 168, 1, 1).To4(),
+		p:  p,
+	}
+
+	d := time.Now().Add(time.Hour)
+	if err := c.SetReadDeadline(d); err != nil {
+		t.Fatal(err)
+	}
+
+	_, stop := c.RequestStream([]net.IP{net.IPv4(192, 168, 1, 10)})
+	<-p.reads
+	stop()
+
+	p.mu.Lock()
+	got := p.deadline
+	p.mu.Unlock()
+
+	if want := d; !want.Equal(got) {
+		t.Fatalf("unexpected read deadline after stop: %v != %v", want, got)
+	}
+}
+
+func TestClientResolveTimeout(t *testing.T) {
+	clientMAC := net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+	clientIP := net.IPv4(192, 168, 1, 1)
+	peerMAC := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	ip := net.IPv4(192, 168, 1, 10)
+
+	reply := mustARPFrame(t, OperationReply, peerMAC, ip, clientMAC, clientIP)
+
+	var tests = []struct {
+		desc   string
+		frames [][]byte
+		rerr   error
+		mac    net.HardwareAddr
+		err    error
+	}{
+		{
+			desc:   "answered",
+			frames: [][]byte{reply},
+			rerr:   &timeoutError{},
+			mac:    peerMAC,
+		},
+		{
+			desc: "timed out",
+			rerr: &timeoutError{},
+			err:  ErrResolveTimeout,
+		},
+		{
+			desc: "read error",
+			rerr: io.ErrUnexpectedEOF,
+			err:  io.ErrUnexpectedEOF,
+		},
+	}
+
+	for i, tt := range tests {
+		p := &deadlineFrameReadFromPacketConn{
+			frameReadFromPacketConn: frameReadFromPacketConn{
+				frames: tt.frames,
+				err:    tt.rerr,
+			},
+		}
+		c := &Client{
+			ifi: &net.Interface{
+				HardwareAddr: clientMAC,
+			},
+			ip: clientIP.To4(),
+			p:  p,
+		}
+
+		mac, err := c.ResolveTimeout(ip, time.Second)
+		if want, got := tt.err, err; want != got {
+			t.Fatalf("[%02d] test %q, unexpected error: %v != %v",
+				i, tt.desc, want, got)
+		}
+		if want, got := tt.mac, mac; !bytes.Equal(want, got) {
+			t.Fatalf("[%02d] test %q, unexpected MAC address: %v != %v",
+				i, tt.desc, want, got)
+		}
+		if !p.deadline.IsZero() {
+			t.Fatalf("[%02d] test %q, read deadline was not cleared: %v",
+				i, tt.desc, p.deadline)
+		}
+	}
+}
+
+func TestClientResolveTrusted(t *testing.T) {
+	clientMAC := net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+	clientIP := net.IPv4(192, 168, 1, 1)
+	trustedMAC := net.HardwareAddr{0x00, 0x1b, 0x21, 0x01, 0x02, 0x03}
+	spoofMAC := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	ip := net.IPv4(192, 168, 1, 10)
+
+	allowed := [][3]byte{{0x00, 0x1b, 0x21}}
+
+	trusted := mustARPFrame(t, OperationReply, trustedMAC, ip, clientMAC, clientIP)
+	spoofed := mustARPFrame(t, OperationReply, spoofMAC, ip, clientMAC, clientIP)
+
+	var tests = []struct {
+		desc   string
+		frames [][]byte
+		mac    net.HardwareAddr
+		err    error
+	}{
+		{
+			desc:   "matching OUI",
+			frames: [][]byte{spoofed, trusted},
+			mac:    trustedMAC,
+		},
+		{
+			desc:   "non-matching OUI",
+			frames: [][]byte{spoofed},
+			err:    ErrNoTrustedResponder,
+		},
+		{
+			desc: "no reply",
+			err:  ErrResolveTimeout,
+		},
+	}
+
+	for i, tt := range tests {
+		p := &deadlineFrameReadFromPacketConn{
+			frameReadFromPacketConn: frameReadFromPacketConn{
+				frames: tt.frames,
+				err:    &timeoutError{},
+			},
+		}
+		c := &Client{
+			ifi: &net.Interface{
+				HardwareAddr: clientMAC,
+			},
+			ip: clientIP.To4(),
+			p:  p,
+		}
+
+		mac, err := c.ResolveTrusted(ip, allowed, time.Second)
+		if want, got := tt.err, err; want != got {
+			t.Fatalf("[%02d] test %q, unexpected error: %v != %v",
+				i, tt.desc, want, got)
+		}
+		if want, got := tt.mac, mac; !bytes.Equal(want, got) {
+			t.Fatalf("[%02d] test %q, unexpected MAC address: %v != %v",
+				i, tt.desc, want, got)
+		}
+		if !p.deadline.IsZero() {
+			t.Fatalf("[%02d] test %q, read deadline was not cleared: %v",
+				i, tt.desc, p.deadline)
+		}
+	}
+}
+
+func TestClientReplySelf(t *testing.T) {
+	clientMAC := net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+	clientIP := net.IPv4(192, 168, 1, 1)
+	peerMAC := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	peerIP := net.IPv4(192, 168, 1, 10)
+
+	p := &frameReadWriteCapturePacketConn{}
+	c := &Client{
+		ifi: &net.Interface{
+			HardwareAddr: clientMAC,
+		},
+		ip: clientIP.To4(),
+		p:  p,
+	}
+
+	other, err := NewPacket(OperationRequest, peerMAC, peerIP, ethernet.Broadcast, net.IPv4(192, 168, 1, 20))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := ErrNotLocalTarget, c.ReplySelf(other); want != got {
+		t.Fatalf("unexpected error for request to another host: %v != %v", want, got)
+	}
+	if want, got := 0, len(p.writes); want != got {
+		t.Fatalf("unexpected number of replies: %v != %v", want, got)
+	}
+
+	req, err := NewPacket(OperationRequest, peerMAC, peerIP, ethernet.Broadcast, clientIP)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.ReplySelf(req); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := 1, len(p.writes); want != got {
+		t.Fatalf("unexpected number of replies: %v != %v", want, got)
+	}
+
+	reply, f, err := parsePacket(p.writes[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := peerMAC, f.Destination; !bytes.Equal(want, got) {
+		t.Fatalf("unexpected ethernet destination: %v != %v", want, got)
+	}
+	if want, got := OperationReply, reply.Operation; want != got {
+		t.Fatalf("unexpected operation: %v != %v", want, got)
+	}
+	if want, got := clientMAC, reply.SenderMAC; !bytes.Equal(want, got) {
+		t.Fatalf("unexpected sender MAC: %v != %v", want, got)
+	}
+	if want, got := clientIP, reply.SenderIP; !want.Equal(got) {
+		t.Fatalf("unexpected sender IP: %v != %v", want, got)
+	}
+}
+
+func TestClientRespond(t *testing.T) {
+	clientMAC := net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+	peerMAC := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	peerIP := net.IPv4(192, 168, 1, 10)
+
+	owned := net.IPv4(192, 168, 1, 20)
+	unowned := net.IPv4(192, 168, 1, 30)
+
+	p := &frameReadWriteCapturePacketConn{
+		frameReadFromPacketConn: frameReadFromPacketConn{
+			frames: [][]byte{
+				mustARPFrame(t, OperationRequest, peerMAC, peerIP, ethernet.Broadcast, unowned),
+				mustARPFrame(t, OperationRequest, peerMAC, peerIP, ethernet.Broadcast, owned),
+			},
+		},
+	}
+
+	c := &Client{
+		ifi: &net.Interface{
+			HardwareAddr: clientMAC,
+		},
+		ip: net.IPv4(192, 168, 1, 1).To4(),
+		p:  p,
+	}
+
+	if err := c.Respond(owned); err != io.EOF {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want, got := 1, len(p.writes); want != got {
+		t.Fatalf("unexpected number of replies: %v != %v", want, got)
+	}
+
+	reply, f, err := parsePacket(p.writes[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := peerMAC, f.Destination; !bytes.Equal(want, got) {
+		t.Fatalf("unexpected ethernet destination: %v != %v", want, got)
+	}
+	if want, got := OperationReply, reply.Operation; want != got {
+		t.Fatalf("unexpected operation: %v != %v", want, got)
+	}
+	if want, got := clientMAC, reply.SenderMAC; !bytes.Equal(want, got) {
+		t.Fatalf("unexpected sender MAC: %v != %v", want, got)
+	}
+	if want, got := owned, reply.SenderIP; !want.Equal(got) {
+		t.Fatalf("unexpected sender IP: %v != %v", want, got)
+	}
+}
+
+func TestClientRespondSelf(t *testing.T) {
+	defer func(addrs func(*net.Interface) ([]net.Addr, error)) {
+		interfaceAddrs = addrs
+	}(interfaceAddrs)
+
+	clientMAC := net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+	peerMAC := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	peerIP := net.IPv4(192, 168, 1, 10)
+
+	owned1 := net.IPv4(192, 168, 1, 1)
+	owned2 := net.IPv4(10, 0, 0, 1)
+	unowned := net.IPv4(192, 168, 1, 30)
+
+	interfaceAddrs = func(*net.Interface) ([]net.Addr, error) {
+		return []net.Addr{
+			&net.IPNet{
+				IP:   owned1,
+				Mask: net.CIDRMask(24, 32),
+			},
+			&net.IPNet{
+				IP:   net.ParseIP("2001:db8::1"),
+				Mask: net.CIDRMask(64, 128),
+			},
+			&net.IPNet{
+				IP:   owned2,
+				Mask: net.CIDRMask(8, 32),
+			},
+		}, nil
+	}
+
+	p := &frameReadWriteCapturePacketConn{
+		frameReadFromPacketConn: frameReadFromPacketConn{
+			frames: [][]byte{
+				mustARPFrame(t, OperationRequest, peerMAC, peerIP, ethernet.Broadcast, unowned),
+				mustARPFrame(t, OperationRequest, peerMAC, peerIP, ethernet.Broadcast, owned1),
+				mustARPFrame(t, OperationRequest, peerMAC, peerIP, ethernet.Broadcast, owned2),
+			},
+		},
+	}
+
+	c := &Client{
+		ifi: &net.Interface{
+			HardwareAddr: clientMAC,
+		},
+		ip: owned1.To4(),
+		p:  p,
+	}
+
+	if err := c.RespondSelf(); err != io.EOF {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want, got := 2, len(p.writes); want != got {
+		t.Fatalf("unexpected number of replies: %v != %v", want, got)
+	}
+
+	for i, want := range []net.IP{owned1, owned2} {
+		reply, _, err := parsePacket(p.writes[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := reply.SenderIP; !want.Equal(got) {
+			t.Fatalf("[%02d] unexpected sender IP: %v != %v", i, want, got)
+		}
+		if want, got := clientMAC, reply.SenderMAC; !bytes.Equal(want, got) {
+			t.Fatalf("[%02d] unexpected sender MAC: %v != %v", i, want, got)
+		}
+	}
+
+	// An interface without IPv4 addresses cannot respond
+	interfaceAddrs = func(*net.Interface) ([]net.Addr, error) {
+		return nil, nil
+	}
+
+	if want, got := errNoIPv4Addr, c.RespondSelf(); want != got {
+		t.Fatalf("unexpected error for no IPv4 addresses: %v != %v", want, got)
+	}
+}
+
+func TestClientRespondIgnoresLocalSender(t *testing.T) {
+	clientMAC := net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+	owned := net.IPv4(192, 168, 1, 20)
+
+	p := &frameReadWriteCapturePacketConn{
+		frameReadFromPacketConn: frameReadFromPacketConn{
+			frames: [][]byte{
+				mustARPFrame(t, OperationRequest, clientMAC, net.IPv4(192, 168, 1, 1), ethernet.Broadcast, owned),
+			},
+		},
+	}
+
+	c := &Client{
+		ifi: &net.Interface{
+			HardwareAddr: clientMAC,
+		},
+		ip: net.IPv4(192, 168, 1, 1).To4(),
+		p:  p,
+	}
+
+	if err := c.Respond(owned); err != io.EOF {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want, got := 0, len(p.writes); want != got {
+		t.Fatalf("unexpected number of replies: %v != %v", want, got)
+	}
+}
+
+func TestClientRespondFunc(t *testing.T) {
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	peerMAC := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	peerIP := net.IPv4(192, 168, 1, 10)
+
+	_, subnet, err := net.ParseCIDR("192.168.1.4/30")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var frames [][]byte
+	for i := byte(2); i <= 9; i++ {
+		frames = append(frames, mustARPFrame(t, OperationRequest, peerMAC, peerIP,
+			ethernet.Broadcast, net.IPv4(192, 168, 1, i)))
+	}
+
+	p := &frameReadWriteCapturePacketConn{
+		frameReadFromPacketConn: frameReadFromPacketConn{
+			frames: frames,
+		},
+	}
+	c := &Client{
+		ifi: &net.Interface{
+			HardwareAddr: net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+		},
+		ip: net.IPv4(192, 168, 1, 1).To4(),
+		p:  p,
+	}
+
+	if err := c.RespondFunc(subnet.Contains, mac); err != io.EOF {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want, got := 4, len(p.writes); want != got {
+		t.Fatalf("unexpected number of replies: %v != %v", want, got)
+	}
+
+	for i, w := range p.writes {
+		reply, _, err := parsePacket(w)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want, got := net.IPv4(192, 168, 1, byte(4+i)), reply.SenderIP; !want.Equal(got) {
+			t.Fatalf("[%02d] unexpected sender IP: %v != %v", i, want, got)
+		}
+		if want, got := mac, reply.SenderMAC; !bytes.Equal(want, got) {
+			t.Fatalf("[%02d] unexpected sender MAC: %v != %v", i, want, got)
+		}
+	}
+}
+
+func TestClientRespondComputed(t *testing.T) {
+	peerMAC := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	peerIP := net.IPv4(192, 168, 1, 10)
+
+	var frames [][]byte
+	for i := byte(1); i <= 3; i++ {
+		frames = append(frames, mustARPFrame(t, OperationRequest, peerMAC, peerIP,
+			ethernet.Broadcast, net.IPv4(10, 0, 0, i)))
+	}
+
+	p := &frameReadWriteCapturePacketConn{
+		frameReadFromPacketConn: frameReadFromPacketConn{
+			frames: frames,
+		},
+	}
+	c := &Client{
+		ifi: &net.Interface{
+			HardwareAddr: net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+		},
+		ip: net.IPv4(10, 0, 0, 254).To4(),
+		p:  p,
+	}
+
+	// Ignore 10.0.0.2, and answer all others with a computed address
+	fn := func(ip net.IP) net.HardwareAddr {
+		if ip.Equal(net.IPv4(10, 0, 0, 2)) {
+			return nil
+		}
+
+		return LocallyAdministeredMAC(ip)
+	}
+
+	if err := c.RespondComputed(fn); err != io.EOF {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want, got := 2, len(p.writes); want != got {
+		t.Fatalf("unexpected number of replies: %v != %v", want, got)
+	}
+
+	for i, ip := range []net.IP{net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 3)} {
+		reply, _, err := parsePacket(p.writes[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want, got := ip, reply.SenderIP; !want.Equal(got) {
+			t.Fatalf("[%02d] unexpected sender IP: %v != %v", i, want, got)
+		}
+		if want, got := LocallyAdministeredMAC(ip), reply.SenderMAC; !bytes.Equal(want, got) {
+			t.Fatalf("[%02d] unexpected sender MAC: %v != %v", i, want, got)
+		}
+	}
+}
+
+func TestLocallyAdministeredMAC(t *testing.T) {
+	var tests = []struct {
+		desc string
+		ip   net.IP
+		mac  net.HardwareAddr
+	}{
+		{
+			desc: "IPv4 address",
+			ip:   net.IPv4(192, 168, 1, 10),
+			mac:  net.HardwareAddr{0x02, 0x00, 192, 168, 1, 10},
+		},
+		{
+			desc: "IPv6 address",
+			ip:   net.IPv6loopback,
+		},
+	}
+
+	for i, tt := range tests {
+		mac := LocallyAdministeredMAC(tt.ip)
+		if want, got := tt.mac, mac; !bytes.Equal(want, got) {
+			t.Fatalf("[%02d] test %q, unexpected MAC: %v != %v",
+				i, tt.desc, want, got)
+		}
+
+		// Locally administered bit set, multicast bit clear
+		if mac != nil && mac[0]&0x03 != 0x02 {
+			t.Fatalf("[%02d] test %q, not a locally administered unicast address: %v",
+				i, tt.desc, mac)
+		}
+	}
+}
+
+func TestClientDefend(t *testing.T) {
+	clientMAC := net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+	peerMAC := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	owned := net.IPv4(192, 168, 1, 1)
+
+	probe, err := NewProbePacket(peerMAC, owned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pb, err := probe.Frame(ethernet.Broadcast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	probeFrame, err := pb.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &frameReadWriteCapturePacketConn{
+		frameReadFromPacketConn: frameReadFromPacketConn{
+			frames: [][]byte{
+				// Ordinary request for the owned address: not a conflict
+				mustARPFrame(t, OperationRequest, peerMAC, net.IPv4(192, 168, 1, 10), ethernet.Broadcast, owned),
+				// Our own announcement: not a conflict
+				mustARPFrame(t, OperationRequest, clientMAC, owned, ethernet.Broadcast, owned),
+				// Conflicting probe, and a repeated conflict within the
+				// defend interval
+				probeFrame,
+				mustARPFrame(t, OperationReply, peerMAC, owned, clientMAC, owned),
+			},
+		},
+	}
+
+	c := &Client{
+		ifi: &net.Interface{
+			HardwareAddr: clientMAC,
+		},
+		ip: owned.To4(),
+		p:  p,
+	}
+
+	if err := c.Defend(owned); err != io.EOF {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want, got := 1, len(p.writes); want != got {
+		t.Fatalf("unexpected number of announcements: %v != %v", want, got)
+	}
+
+	a, f, err := parsePacket(p.writes[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := ethernet.Broadcast, f.Destination; !bytes.Equal(want, got) {
+		t.Fatalf("unexpected ethernet destination: %v != %v", want, got)
+	}
+	if want, got := KindAnnouncement, Classify(a); want != got {
+		t.Fatalf("unexpected packet kind: %v != %v", want, got)
+	}
+	if want, got := clientMAC, a.SenderMAC; !bytes.Equal(want, got) {
+		t.Fatalf("unexpected sender MAC: %v != %v", want, got)
+	}
+	if want, got := owned, a.SenderIP; !want.Equal(got) {
+		t.Fatalf("unexpected sender IP: %v != %v", want, got)
+	}
+}
+
+func TestClientDefendSourceMAC(t *testing.T) {
+	clientMAC := net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+	sourceMAC := net.HardwareAddr{0x02, 0x00, 0xc0, 0xa8, 0x01, 0x01}
+	peerMAC := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	owned := net.IPv4(192, 168, 1, 1)
+	other := net.IPv4(192, 168, 1, 2)
+
+	p := &frameReadWriteCapturePacketConn{
+		frameReadFromPacketConn: frameReadFromPacketConn{
+			frames: [][]byte{
+				// Packets from the interface's own hardware address and
+				// from the source MAC are both local: not conflicts
+				mustARPFrame(t, OperationReply, clientMAC, other, peerMAC, net.IPv4(192, 168, 1, 10)),
+				mustARPFrame(t, OperationRequest, sourceMAC, other, ethernet.Broadcast, other),
+				// Conflicting reply from another host
+				mustARPFrame(t, OperationReply, peerMAC, owned, clientMAC, owned),
+			},
+		},
+	}
+
+	c := &Client{
+		ifi: &net.Interface{
+			HardwareAddr: clientMAC,
+		},
+		ip: owned.To4(),
+		p:  p,
+	}
+	if err := c.SetSourceMAC(sourceMAC); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Defend(owned, other); err != io.EOF {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want, got := 1, len(p.writes); want != got {
+		t.Fatalf("unexpected number of announcements: %v != %v", want, got)
+	}
+
+	a, _, err := parsePacket(p.writes[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := sourceMAC, a.SenderMAC; !bytes.Equal(want, got) {
+		t.Fatalf("unexpected sender MAC: %v != %v", want, got)
+	}
+	if want, got := owned, a.SenderIP; !want.Equal(got) {
+		t.Fatalf("unexpected sender IP: %v != %v", want, got)
+	}
+}
+
+func TestClientConcurrentRequestRead(t *testing.T) {
+	peerMAC := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	peerIP := net.IPv4(192, 168, 1, 10)
+	ip := net.IPv4(192, 168, 1, 1)
+
+	var frames [][]byte
+	for i := 0; i < 16; i++ {
+		frames = append(frames, mustARPFrame(t, OperationRequest, peerMAC, peerIP, ethernet.Broadcast, ip))
+	}
+
+	p := &frameReadWriteCapturePacketConn{
+		frameReadFromPacketConn: frameReadFromPacketConn{
+			frames: frames,
+		},
+	}
+
+	c := &Client{
+		ifi: &net.Interface{
+			HardwareAddr: net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+		},
+		ip: ip.To4(),
+		p:  p,
+	}
+
+	const n = 4
+
+	var wg sync.WaitGroup
+	wg.Add(n + 2)
+
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			defer wg.Done()
+			if err := c.Request(net.IPv4(192, 168, 1, byte(100+i))); err != nil {
+				t.Error(err)
+				return
+			}
+		}(i)
+	}
+
+	// Two readers consume all frames between them, without any frame
+	// being read twice
+	reads := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			defer wg.Done()
+
+			var count int
+			for {
+				if _, _, err := c.Read(); err != nil {
+					reads <- count
+					return
+				}
+				count++
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if want, got := n, len(p.writes); want != got {
+		t.Fatalf("unexpected number of requests written: %v != %v", want, got)
+	}
+	if want, got := len(frames), <-reads+<-reads; want != got {
+		t.Fatalf("unexpected number of packets read: %v != %v", want, got)
+	}
+}
+
+func TestClientConcurrentSettings(t *testing.T) {
+	peerMAC := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	peerIP := net.IPv4(192, 168, 1, 10)
+	ip := net.IPv4(192, 168, 1, 1)
+	mac := net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+
+	var frames [][]byte
+	for i := 0; i < 16; i++ {
+		frames = append(frames, mustARPFrame(t, OperationRequest, peerMAC, peerIP, ethernet.Broadcast, ip))
+	}
+
+	c := &Client{
+		ifi: &net.Interface{
+			HardwareAddr: mac,
+		},
+		ip: ip.To4(),
+		p: &frameReadWriteCapturePacketConn{
+			frameReadFromPacketConn: frameReadFromPacketConn{
+				frames: frames,
+			},
+		},
+	}
+
+	// Run with the race detector to verify settings may be changed while
+	// the Client is reading and writing
+	var wg sync.WaitGroup
+	wg.Add(3)
+
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 16; i++ {
+			c.SetStrictValidation(i%2 == 0)
+			c.SetReadBufferSize(DefaultReadBufferSize + i)
+			c.SetAllowForeignMedium(i%2 == 0)
+			c.SetLogger(nil)
+			if err := c.SetSourceMAC(mac); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 16; i++ {
+			if err := c.Request(peerIP); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		for {
+			if _, _, err := c.Read(); err != nil {
+				return
+			}
+		}
+	}()
+
+	wg.Wait()
+}
+
+// frameReadWriteCapturePacketConn is a net.PacketConn which reads frames
+// like frameReadFromPacketConn, and captures each frame passed to its
+// WriteTo method
+type frameReadWriteCapturePacketConn struct {
+	frameReadFromPacketConn
+
+	writes [][]byte
+}
+
+func (p *frameReadWriteCapturePacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	p.writes = append(p.writes, append([]byte(nil), b...))
+	return len(b), nil
+}
+
+// attemptReplyPacketConn is a net.PacketConn which captures written frames,
+// and returns reply from ReadFrom once attempt frames have been written.
+// Otherwise, and once reply is returned, ReadFrom returns a timeout error.
+// If attempt is zero, reply is never returned
+type attemptReplyPacketConn struct {
+	attempt int
+	reply   []byte
+
+	writes [][]byte
+
+	noopPacketConn
+}
+
+func (p *attemptReplyPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	if p.attempt == 0 || len(p.writes) != p.attempt || p.reply == nil {
+		return 0, nil, &timeoutError{}
+	}
+
+	n := copy(b, p.reply)
+	p.reply = nil
+	return n, nil, nil
+}
+
+func (p *attemptReplyPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	p.writes = append(p.writes, append([]byte(nil), b...))
+	return len(b), nil
+}
+
+// frameReadFromPacketConn is a net.PacketConn which returns a single frame
+// from its embedded frames each time its ReadFrom method is called. Once
+// all frames are consumed, err is returned, or io.EOF if err is nil
+type frameReadFromPacketConn struct {
+	frames [][]byte
+	err    error
+
+	noopPacketConn
+}
+
+func (p *frameReadFromPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	if len(p.frames) == 0 {
+		if p.err != nil {
+			return 0, nil, p.err
+		}
+
+		return 0, nil, io.EOF
+	}
+
+	n := copy(b, p.frames[0])
+	p.frames = p.frames[1:]
+	return n, nil, nil
+}
+
+// deadlineFrameReadFromPacketConn is a frameReadFromPacketConn which also
+// captures the most recently set read deadline
+type deadlineFrameReadFromPacketConn struct {
+	deadline time.Time
+
+	frameReadFromPacketConn
+}
+
+func (p *deadlineFrameReadFromPacketConn) SetReadDeadline(t time.Time) error {
+	p.deadline = t
+	return nil
+}
+
 // bufferReadFromPacketConn is a net.PacketConn which copies bytes from its
 // embedded buffer into b when its ReadFrom method is called
 type bufferReadFromPacketConn struct {
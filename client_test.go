@@ -1,10 +1,18 @@
 package arp
 
 import (
+	"bytes"
+	"errors"
 	"net"
+	"os"
 	"reflect"
+	"sync"
+	"syscall"
 	"testing"
 	"time"
+
+	"github.com/caser789/ethernet"
+	"github.com/caser789/raw"
 )
 
 func TestClientClose(t *testing.T) {
@@ -20,6 +28,145 @@ func TestClientClose(t *testing.T) {
 	}
 }
 
+func TestClientCloseIdempotent(t *testing.T) {
+	p := &blockingReadFromPacketConn{
+		done: make(chan struct{}),
+	}
+	c := &Client{p: p}
+
+	for i := 0; i < 3; i++ {
+		if err := c.Close(); err != nil {
+			t.Fatalf("[%02d] unexpected error: %v", i, err)
+		}
+	}
+
+	if want, got := 1, p.closes; want != got {
+		t.Fatalf("unexpected number of closes: %v != %v", want, got)
+	}
+
+	if _, _, err := c.Read(); err != ErrClosed {
+		t.Fatalf("unexpected error reading closed client: %v != %v", ErrClosed, err)
+	}
+}
+
+func TestClientCloseDuringRead(t *testing.T) {
+	p := &blockingReadFromPacketConn{
+		done: make(chan struct{}),
+	}
+	c := &Client{p: p}
+
+	errC := make(chan error, 1)
+	go func() {
+		_, _, err := c.Read()
+		errC <- err
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = c.Close()
+		}()
+	}
+	wg.Wait()
+
+	if err := <-errC; err != ErrClosed {
+		t.Fatalf("unexpected error from blocked read: %v != %v", ErrClosed, err)
+	}
+
+	if want, got := 1, p.closes; want != got {
+		t.Fatalf("unexpected number of closes: %v != %v", want, got)
+	}
+}
+
+func TestClientAccessors(t *testing.T) {
+	mac := net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+	ip := net.IPv4(192, 168, 1, 1).To4()
+	c := &Client{
+		ifi: &net.Interface{
+			Index:        2,
+			Name:         "eth0",
+			HardwareAddr: mac,
+		},
+		ip: ip,
+	}
+
+	ifi := c.Interface()
+	if want, got := "eth0", ifi.Name; want != got {
+		t.Fatalf("unexpected interface name: %v != %v", want, got)
+	}
+	if want, got := 2, ifi.Index; want != got {
+		t.Fatalf("unexpected interface index: %v != %v", want, got)
+	}
+
+	// Modifying returned values must not affect the Client
+	ifi.Name = "eth1"
+	ifi.HardwareAddr[0] = 0x00
+	c.HardwareAddr()[1] = 0x00
+	c.LocalIP()[0] = 10
+
+	if want, got := "eth0", c.Interface().Name; want != got {
+		t.Fatalf("unexpected interface name after modification: %v != %v", want, got)
+	}
+	if want, got := (net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}), c.HardwareAddr(); !bytes.Equal(want, got) {
+		t.Fatalf("unexpected hardware address after modification: %v != %v", want, got)
+	}
+	if want, got := net.IPv4(192, 168, 1, 1), c.LocalIP(); !want.Equal(got) {
+		t.Fatalf("unexpected local IP after modification: %v != %v", want, got)
+	}
+}
+
+func TestNewInterfaceNoMAC(t *testing.T) {
+	ifi := &net.Interface{
+		Index: 1,
+		Name:  "tun0",
+	}
+
+	if _, err := New(ifi, &noopPacketConn{}); err != ErrInterfaceNoMAC {
+		t.Fatalf("unexpected error from New: %v != %v", ErrInterfaceNoMAC, err)
+	}
+	if _, err := Dial(ifi); err != ErrInterfaceNoMAC {
+		t.Fatalf("unexpected error from Dial: %v != %v", ErrInterfaceNoMAC, err)
+	}
+}
+
+func Test_wrapListenError(t *testing.T) {
+	var tests = []struct {
+		desc      string
+		err       error
+		privilege bool
+	}{
+		{
+			desc:      "EPERM",
+			err:       os.NewSyscallError("socket", syscall.EPERM),
+			privilege: true,
+		},
+		{
+			desc:      "EACCES",
+			err:       syscall.EACCES,
+			privilege: true,
+		},
+		{
+			desc: "ENODEV",
+			err:  os.NewSyscallError("bind", syscall.ENODEV),
+		},
+	}
+
+	for i, tt := range tests {
+		err := wrapListenError(tt.err)
+
+		if want, got := tt.privilege, errors.Is(err, ErrInsufficientPrivilege); want != got {
+			t.Fatalf("[%02d] test %q, unexpected privilege error match: %v != %v",
+				i, tt.desc, want, got)
+		}
+		if !errors.Is(err, tt.err) {
+			t.Fatalf("[%02d] test %q, underlying error not preserved: %v",
+				i, tt.desc, err)
+		}
+	}
+}
+
 func TestClientSetDeadline(t *testing.T) {
 	p := &deadlineCapturePacketConn{}
 	c := &Client{p: p}
@@ -37,6 +184,46 @@ func TestClientSetDeadline(t *testing.T) {
 	}
 }
 
+func TestClientDeadlineContext(t *testing.T) {
+	c := &Client{p: &deadlineCapturePacketConn{}}
+
+	ctx, cancel := c.DeadlineContext()
+	if _, ok := ctx.Deadline(); ok {
+		t.Fatal("expected no deadline before one is set")
+	}
+	cancel()
+
+	d := time.Now().Add(time.Hour)
+	if err := c.SetReadDeadline(d); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel = c.DeadlineContext()
+	defer cancel()
+
+	got, ok := ctx.Deadline()
+	if !ok {
+		t.Fatal("expected context deadline")
+	}
+	if want := d; !want.Equal(got) {
+		t.Fatalf("unexpected context deadline: %v != %v", want, got)
+	}
+
+	// Derived contexts are not affected by later deadlines
+	if err := c.SetDeadline(time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ctx.Deadline(); !d.Equal(got) {
+		t.Fatalf("unexpected context deadline after change: %v != %v", d, got)
+	}
+
+	ctx, cancel = c.DeadlineContext()
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Fatal("expected no deadline after it was cleared")
+	}
+}
+
 func TestClientSetReadDeadline(t *testing.T) {
 	p := &deadlineCapturePacketConn{}
 	c := &Client{p: p}
@@ -71,6 +258,247 @@ func TestClientSetWriteDeadline(t *testing.T) {
 	}
 }
 
+func TestClientWriteToTimeout(t *testing.T) {
+	p := &writeDeadlineCapturePacketConn{}
+	c := &Client{
+		ifi: &net.Interface{
+			HardwareAddr: net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+		},
+		p: p,
+	}
+
+	mac := net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+	arp, err := NewPacket(OperationRequest, mac, net.IPv4(192, 168, 1, 1), ethernet.Broadcast, net.IPv4(192, 168, 1, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if err := c.WriteToTimeout(arp, ethernet.Broadcast, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	if p.writeDeadline.Before(start.Add(time.Minute)) {
+		t.Fatalf("unexpected write deadline during write: %v", p.writeDeadline)
+	}
+	if want, got := (time.Time{}), p.w; want != got {
+		t.Fatalf("unexpected write deadline after write: %v != %v", want, got)
+	}
+}
+
+func TestClientWriteFrame(t *testing.T) {
+	p := &writeToCapturePacketConn{}
+	c := &Client{p: p}
+
+	fb := []byte{0xde, 0xad, 0xbe, 0xef}
+	addr := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+
+	n, err := c.WriteFrame(fb, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := len(fb), n; want != got {
+		t.Fatalf("unexpected number of bytes written: %v != %v", want, got)
+	}
+	if want, got := fb, p.b; !bytes.Equal(want, got) {
+		t.Fatalf("unexpected frame bytes: %v != %v", want, got)
+	}
+	if want, got := (&raw.Addr{HardwareAddr: addr}), p.addr; !reflect.DeepEqual(want, got) {
+		t.Fatalf("unexpected address: %v != %v", want, got)
+	}
+}
+
+func TestClientWriteToN(t *testing.T) {
+	p := &writeToCapturePacketConn{}
+	c := &Client{
+		ifi: &net.Interface{
+			HardwareAddr: net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+		},
+		p: p,
+	}
+
+	mac := net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+	arp, err := NewPacket(OperationRequest, mac, net.IPv4(192, 168, 1, 1), ethernet.Broadcast, net.IPv4(192, 168, 1, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := c.WriteToN(arp, ethernet.Broadcast)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := len(p.b), n; want != got {
+		t.Fatalf("unexpected number of bytes written: %v != %v", want, got)
+	}
+	if want, got := 14+arp.Len(), n; want > got {
+		t.Fatalf("too few bytes written for frame: %v > %v", want, got)
+	}
+}
+
+func TestClientWriteToShortAddress(t *testing.T) {
+	p := &writeToCapturePacketConn{}
+	mac := net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+	c := &Client{
+		ifi: &net.Interface{
+			HardwareAddr: mac,
+		},
+		p: p,
+	}
+
+	arp, err := NewPacket(OperationRequest, mac, net.IPv4(192, 168, 1, 1), ethernet.Broadcast, net.IPv4(192, 168, 1, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Short addresses would leave bytes of a previous frame in the header
+	if want, got := ErrInvalidMAC, c.WriteTo(arp, net.HardwareAddr{0xaa, 0xbb}); want != got {
+		t.Fatalf("unexpected error for short destination: %v != %v", want, got)
+	}
+
+	arp.SenderMAC = arp.SenderMAC[:4]
+	if want, got := ErrInvalidMAC, c.WriteTo(arp, ethernet.Broadcast); want != got {
+		t.Fatalf("unexpected error for short sender: %v != %v", want, got)
+	}
+
+	if p.b != nil {
+		t.Fatalf("unexpected frame written: %v", p.b)
+	}
+}
+
+func TestClientWriteToMACLengthMismatch(t *testing.T) {
+	p := &writeToCapturePacketConn{}
+	c := &Client{
+		ifi: &net.Interface{
+			Name:         "eth0",
+			HardwareAddr: net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+		},
+		p: p,
+	}
+
+	mac := net.HardwareAddr(bytes.Repeat([]byte{0xaa}, 20))
+	arp, err := NewPacket(OperationRequest, mac, net.IPv4(192, 168, 1, 1), ethernet.Broadcast, net.IPv4(192, 168, 1, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.WriteTo(arp, ethernet.Broadcast); !errors.Is(err, ErrMACLengthMismatch) {
+		t.Fatalf("unexpected error: %v != %v", ErrMACLengthMismatch, err)
+	}
+	if p.b != nil {
+		t.Fatalf("unexpected frame written: %v", p.b)
+	}
+
+	// Relays may carry packets for another medium
+	c.SetAllowForeignMedium(true)
+	if err := c.WriteTo(arp, ethernet.Broadcast); err != nil {
+		t.Fatal(err)
+	}
+	if p.b == nil {
+		t.Fatal("no frame written")
+	}
+}
+
+func TestClientWriteToPooledConcurrent(t *testing.T) {
+	p := &lockedWriteCapturePacketConn{}
+	c := &Client{
+		ifi: &net.Interface{
+			HardwareAddr: net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+		},
+		p: p,
+
+		// Packets for both ethernet and InfiniBand are written
+		allowForeignMedium: true,
+	}
+
+	// Packets of differing lengths ensure stale bytes from a reused buffer
+	// would be detected
+	var want [][]byte
+	var arps []*Packet
+	for i := 0; i < 16; i++ {
+		ml := 6
+		if i%2 == 1 {
+			ml = 20
+		}
+
+		mac := make(net.HardwareAddr, ml)
+		for j := range mac {
+			mac[j] = byte(i + 1)
+		}
+
+		arp, err := NewPacket(OperationRequest, mac, net.IPv4(192, 168, 1, byte(i)), mac, net.IPv4(192, 168, 1, 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := arp.Frame(ethernet.Broadcast)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fb, err := f.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		arps = append(arps, arp)
+		want = append(want, fb)
+	}
+
+	var wg sync.WaitGroup
+	for i := range arps {
+		wg.Add(1)
+		go func(arp *Packet) {
+			defer wg.Done()
+
+			for j := 0; j < 50; j++ {
+				if err := c.WriteTo(arp, ethernet.Broadcast); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(arps[i])
+	}
+	wg.Wait()
+
+	if want, got := len(arps)*50, len(p.writes); want != got {
+		t.Fatalf("unexpected number of writes: %v != %v", want, got)
+	}
+
+	for i, got := range p.writes {
+		var ok bool
+		for _, w := range want {
+			if bytes.Equal(w, got) {
+				ok = true
+				break
+			}
+		}
+
+		if !ok {
+			t.Fatalf("[%02d] unexpected frame bytes: %v", i, got)
+		}
+	}
+}
+
+func BenchmarkClientWriteTo(b *testing.B) {
+	c := &Client{p: &noopPacketConn{}}
+
+	mac := net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+	arp, err := NewPacket(OperationReply, mac, net.IPv4(192, 168, 1, 1), mac, net.IPv4(192, 168, 1, 10))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := c.WriteTo(arp, mac); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func TestClientHardwareAddr(t *testing.T) {
 	c := &Client{
 		ifi: &net.Interface{
@@ -83,6 +511,441 @@ func TestClientHardwareAddr(t *testing.T) {
 	}
 }
 
+func TestClientSetSourceMAC(t *testing.T) {
+	p := &writeToCapturePacketConn{}
+	c := &Client{
+		ifi: &net.Interface{
+			HardwareAddr: net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+		},
+		ip: net.IPv4(192, 168, 1, 1).To4(),
+		p:  p,
+	}
+
+	if want, got := ErrInvalidMAC, c.SetSourceMAC(net.HardwareAddr{0, 1, 2, 3}); want != got {
+		t.Fatalf("unexpected error for invalid MAC: %v != %v", want, got)
+	}
+
+	mac := net.HardwareAddr{0x02, 0x00, 0xc0, 0xa8, 0x01, 0x01}
+	if err := c.SetSourceMAC(mac); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Request(net.IPv4(192, 168, 1, 10)); err != nil {
+		t.Fatal(err)
+	}
+
+	arp, f, err := parsePacket(p.b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := mac, arp.SenderMAC; !bytes.Equal(want, got) {
+		t.Fatalf("unexpected sender MAC: %v != %v", want, got)
+	}
+	if want, got := mac, f.Source; !bytes.Equal(want, got) {
+		t.Fatalf("unexpected frame source MAC: %v != %v", want, got)
+	}
+	if want, got := c.ifi.HardwareAddr, c.HardwareAddr(); !bytes.Equal(want, got) {
+		t.Fatalf("interface hardware address should not change: %v != %v", want, got)
+	}
+
+	// A nil address restores the interface's hardware address
+	if err := c.SetSourceMAC(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Request(net.IPv4(192, 168, 1, 10)); err != nil {
+		t.Fatal(err)
+	}
+
+	arp, _, err = parsePacket(p.b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := c.ifi.HardwareAddr, arp.SenderMAC; !bytes.Equal(want, got) {
+		t.Fatalf("unexpected sender MAC: %v != %v", want, got)
+	}
+}
+
+func TestClientWriteToVLAN(t *testing.T) {
+	p := &writeToCapturePacketConn{}
+	c := &Client{
+		ifi: &net.Interface{
+			HardwareAddr: net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+		},
+		p: p,
+	}
+
+	mac := net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+	arp, err := NewPacket(OperationRequest, mac, net.IPv4(192, 168, 1, 1), ethernet.Broadcast, net.IPv4(192, 168, 1, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.WriteToVLAN(arp, 10, ethernet.Broadcast); err != nil {
+		t.Fatal(err)
+	}
+
+	f := new(ethernet.Frame)
+	if err := f.UnmarshalBinary(p.b); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := 1, len(f.VLAN); want != got {
+		t.Fatalf("unexpected number of VLAN tags: %v != %v", want, got)
+	}
+	if want, got := uint16(10), f.VLAN[0].ID; want != got {
+		t.Fatalf("unexpected VLAN ID: %v != %v", want, got)
+	}
+	if want, got := ethernet.EtherTypeARP, f.EtherType; want != got {
+		t.Fatalf("unexpected EtherType: %v != %v", want, got)
+	}
+
+	if want, got := ethernet.ErrInvalidVLAN, c.WriteToVLAN(arp, 4095, ethernet.Broadcast); want != got {
+		t.Fatalf("unexpected error for invalid VLAN ID: %v != %v", want, got)
+	}
+}
+
+func TestClientOnLink(t *testing.T) {
+	c := &Client{
+		subnets: []*net.IPNet{
+			{
+				IP:   net.IPv4(10, 0, 0, 0).To4(),
+				Mask: []byte{255, 0, 0, 0},
+			},
+			{
+				IP:   net.IPv4(192, 168, 1, 0).To4(),
+				Mask: []byte{255, 255, 255, 0},
+			},
+		},
+	}
+
+	var tests = []struct {
+		ip net.IP
+		ok bool
+	}{
+		{ip: net.IPv4(10, 1, 2, 3), ok: true},
+		{ip: net.IPv4(192, 168, 1, 254), ok: true},
+		{ip: net.IPv4(192, 168, 2, 1)},
+		{ip: net.IPv4(172, 16, 0, 1)},
+	}
+
+	for i, tt := range tests {
+		if want, got := tt.ok, c.OnLink(tt.ip); want != got {
+			t.Fatalf("[%02d] unexpected on-link result for %v: %v != %v",
+				i, tt.ip, want, got)
+		}
+	}
+}
+
+func TestClientSubnets(t *testing.T) {
+	addrs := []net.Addr{
+		&net.IPNet{
+			IP:   net.IPv4(192, 168, 1, 1),
+			Mask: net.CIDRMask(24, 32),
+		},
+		&net.IPNet{
+			IP:   net.ParseIP("2001:db8::1"),
+			Mask: net.CIDRMask(64, 128),
+		},
+		&net.IPNet{
+			IP:   net.IPv4(10, 0, 0, 1),
+			Mask: net.CIDRMask(8, 32),
+		},
+	}
+
+	c, err := newClient(&net.Interface{}, &noopPacketConn{}, addrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subnets := c.Subnets()
+	if want, got := 2, len(subnets); want != got {
+		t.Fatalf("unexpected number of subnets: %v != %v", want, got)
+	}
+
+	for i, want := range []string{"192.168.1.0/24", "10.0.0.0/8"} {
+		if got := subnets[i].String(); want != got {
+			t.Fatalf("[%02d] unexpected subnet: %v != %v", i, want, got)
+		}
+	}
+
+	// Modifying the returned subnets must not affect the Client
+	subnets[0].IP[0] = 172
+	if !c.OnLink(net.IPv4(192, 168, 1, 10)) {
+		t.Fatal("client subnets were modified through Subnets")
+	}
+
+	var tests = []struct {
+		ip net.IP
+		ok bool
+	}{
+		{ip: net.IPv4(192, 168, 1, 254), ok: true},
+		{ip: net.IPv4(10, 20, 30, 40), ok: true},
+		{ip: net.IPv4(172, 16, 0, 1)},
+		{ip: net.ParseIP("2001:db8::2")},
+	}
+
+	for i, tt := range tests {
+		if want, got := tt.ok, c.OnLink(tt.ip); want != got {
+			t.Fatalf("[%02d] unexpected on-link result for %v: %v != %v",
+				i, tt.ip, want, got)
+		}
+	}
+}
+
+func TestClientHasIPv4(t *testing.T) {
+	ipv4 := &net.IPNet{
+		IP:   net.IPv4(192, 168, 1, 1),
+		Mask: net.CIDRMask(24, 32),
+	}
+	ipv6 := &net.IPNet{
+		IP:   net.ParseIP("2001:db8::1"),
+		Mask: net.CIDRMask(64, 128),
+	}
+
+	var tests = []struct {
+		desc  string
+		addrs []net.Addr
+		ok    bool
+		warn  error
+	}{
+		{
+			desc: "no addresses",
+		},
+		{
+			desc:  "IPv6 address only",
+			addrs: []net.Addr{ipv6},
+			warn:  ErrIPv6Only,
+		},
+		{
+			desc:  "IPv4 address only",
+			addrs: []net.Addr{ipv4},
+			ok:    true,
+		},
+		{
+			desc:  "IPv4 and IPv6 addresses",
+			addrs: []net.Addr{ipv6, ipv4},
+			ok:    true,
+		},
+	}
+
+	for i, tt := range tests {
+		c, err := newClient(&net.Interface{}, &noopPacketConn{}, tt.addrs)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want, got := tt.ok, c.HasIPv4(); want != got {
+			t.Fatalf("[%02d] test %q, unexpected HasIPv4 result: %v != %v",
+				i, tt.desc, want, got)
+		}
+		if want, got := tt.warn, c.Warning(); want != got {
+			t.Fatalf("[%02d] test %q, unexpected warning: %v != %v",
+				i, tt.desc, want, got)
+		}
+	}
+}
+
+func TestClientRefresh(t *testing.T) {
+	defer func(byName func(string) (*net.Interface, error), addrs func(*net.Interface) ([]net.Addr, error)) {
+		interfaceByName = byName
+		interfaceAddrs = addrs
+	}(interfaceByName, interfaceAddrs)
+
+	oldMAC := net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+	newMAC := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+
+	interfaceAddrs = func(*net.Interface) ([]net.Addr, error) {
+		return []net.Addr{
+			&net.IPNet{
+				IP:   net.IPv4(192, 168, 1, 2),
+				Mask: []byte{255, 255, 255, 0},
+			},
+		}, nil
+	}
+
+	var tests = []struct {
+		desc   string
+		ifi    *net.Interface
+		listen bool
+		reopen bool
+		closed bool
+		err    error
+	}{
+		{
+			desc: "interface not found",
+			err:  ErrInterfaceNotFound,
+		},
+		{
+			desc: "closed",
+			ifi: &net.Interface{
+				Index:        2,
+				Name:         "eth0",
+				HardwareAddr: oldMAC,
+			},
+			listen: true,
+			closed: true,
+			err:    ErrClosed,
+		},
+		{
+			desc: "interface unchanged",
+			ifi: &net.Interface{
+				Index:        1,
+				Name:         "eth0",
+				HardwareAddr: oldMAC,
+			},
+		},
+		{
+			desc: "hardware address changed, not created using Dial",
+			ifi: &net.Interface{
+				Index:        1,
+				Name:         "eth0",
+				HardwareAddr: newMAC,
+			},
+			err: ErrRefreshUnsupported,
+		},
+		{
+			desc: "index changed",
+			ifi: &net.Interface{
+				Index:        2,
+				Name:         "eth0",
+				HardwareAddr: oldMAC,
+			},
+			listen: true,
+			reopen: true,
+		},
+	}
+
+	for i, tt := range tests {
+		interfaceByName = func(name string) (*net.Interface, error) {
+			if tt.ifi == nil {
+				return nil, errors.New("no such network interface")
+			}
+
+			return tt.ifi, nil
+		}
+
+		oldP := &closeCapturePacketConn{}
+		c := &Client{
+			ifi: &net.Interface{
+				Index:        1,
+				Name:         "eth0",
+				HardwareAddr: oldMAC,
+			},
+			ip: net.IPv4(192, 168, 1, 1).To4(),
+			p:  oldP,
+		}
+
+		newP := &noopPacketConn{}
+		var listened bool
+		if tt.listen {
+			c.listen = func(*net.Interface) (net.PacketConn, error) {
+				listened = true
+				return newP, nil
+			}
+		}
+
+		if tt.closed {
+			if err := c.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := c.Refresh(); err != nil {
+			if want, got := tt.err, err; want != got {
+				t.Fatalf("[%02d] test %q, unexpected error: %v != %v",
+					i, tt.desc, want, got)
+			}
+			if listened {
+				t.Fatalf("[%02d] test %q, socket was opened despite error", i, tt.desc)
+			}
+
+			continue
+		}
+
+		if want, got := net.IPv4(192, 168, 1, 2), c.ip; !want.Equal(got) {
+			t.Fatalf("[%02d] test %q, unexpected IPv4 address: %v != %v",
+				i, tt.desc, want, got)
+		}
+		if want, got := tt.ifi, c.ifi; want != got {
+			t.Fatalf("[%02d] test %q, interface was not updated", i, tt.desc)
+		}
+
+		if tt.reopen {
+			if c.p != newP || !oldP.closed {
+				t.Fatalf("[%02d] test %q, socket was not reopened", i, tt.desc)
+			}
+
+			continue
+		}
+
+		if c.p != oldP || oldP.closed {
+			t.Fatalf("[%02d] test %q, socket was unexpectedly reopened", i, tt.desc)
+		}
+	}
+}
+
+func TestClientRefreshConcurrentWriteTo(t *testing.T) {
+	defer func(byName func(string) (*net.Interface, error), addrs func(*net.Interface) ([]net.Addr, error)) {
+		interfaceByName = byName
+		interfaceAddrs = addrs
+	}(interfaceByName, interfaceAddrs)
+
+	mac := net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+
+	interfaceByName = func(name string) (*net.Interface, error) {
+		return &net.Interface{
+			Index:        1,
+			Name:         name,
+			HardwareAddr: mac,
+		}, nil
+	}
+	interfaceAddrs = func(*net.Interface) ([]net.Addr, error) {
+		return []net.Addr{
+			&net.IPNet{
+				IP:   net.IPv4(192, 168, 1, 1),
+				Mask: []byte{255, 255, 255, 0},
+			},
+		}, nil
+	}
+
+	c := &Client{
+		ifi: &net.Interface{
+			Index:        1,
+			Name:         "eth0",
+			HardwareAddr: mac,
+		},
+		ip: net.IPv4(192, 168, 1, 1).To4(),
+		p:  &lockedWriteCapturePacketConn{},
+	}
+
+	arp, err := NewPacket(OperationRequest, mac, net.IPv4(192, 168, 1, 1), ethernet.Broadcast, net.IPv4(192, 168, 1, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Run with the race detector to verify writes do not race with Refresh
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			if err := c.WriteTo(arp, ethernet.Broadcast); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		if err := c.Refresh(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+}
+
 func Test_newClient(t *testing.T) {
 	var tests = []struct {
 		desc  string
@@ -104,6 +967,10 @@ func Test_newClient(t *testing.T) {
 			},
 			c: &Client{
 				ip: net.IPv4(192, 168, 1, 1).To4(),
+				subnets: []*net.IPNet{{
+					IP:   net.IPv4(192, 168, 1, 0).To4(),
+					Mask: []byte{255, 255, 255, 0},
+				}},
 			},
 		},
 	}
@@ -126,6 +993,50 @@ func Test_newClient(t *testing.T) {
 	}
 }
 
+func Test_ipv4Subnets(t *testing.T) {
+	addrs := []net.Addr{
+		&net.UnixAddr{
+			Name: "foo.sock",
+			Net:  "unix",
+		},
+		&net.IPNet{
+			IP: net.IPv4(172, 16, 0, 1),
+		},
+		&net.IPNet{
+			IP: net.IPv6loopback,
+			Mask: []byte{
+				0xff, 0xff, 0xff, 0xff,
+				0xff, 0xff, 0xff, 0xff,
+				0, 0, 0, 0,
+				0, 0, 0, 0,
+			},
+		},
+		&net.IPNet{
+			IP:   net.IPv4(10, 0, 0, 1),
+			Mask: []byte{255, 0, 0, 0},
+		},
+		&net.IPNet{
+			IP:   net.IPv4(192, 168, 1, 1),
+			Mask: []byte{255, 255, 255, 0},
+		},
+	}
+
+	want := []*net.IPNet{
+		{
+			IP:   net.IPv4(10, 0, 0, 0).To4(),
+			Mask: []byte{255, 0, 0, 0},
+		},
+		{
+			IP:   net.IPv4(192, 168, 1, 0).To4(),
+			Mask: []byte{255, 255, 255, 0},
+		},
+	}
+
+	if got := ipv4Subnets(addrs); !reflect.DeepEqual(want, got) {
+		t.Fatalf("unexpected IPv4 subnets:\n- want: %v\n- got: %v", want, got)
+	}
+}
+
 func Test_firstIPv4Addr(t *testing.T) {
 	var tests = []struct {
 		desc  string
@@ -157,6 +1068,35 @@ func Test_firstIPv4Addr(t *testing.T) {
 				Text: "<nil>",
 			},
 		},
+		{
+			desc: "bad CIDR address and IPv4 address",
+			addrs: []net.Addr{
+				&net.IPNet{
+					IP: net.IPv4(10, 0, 0, 1),
+				},
+				&net.IPNet{
+					IP:   net.IPv4(192, 168, 1, 1),
+					Mask: []byte{255, 255, 255, 0},
+				},
+			},
+			ip: net.IPv4(192, 168, 1, 1),
+		},
+		{
+			desc: "bad CIDR address and IPv6 address",
+			addrs: []net.Addr{
+				&net.IPNet{
+					IP: net.IPv4(192, 168, 1, 1),
+				},
+				&net.IPNet{
+					IP:   net.IPv6loopback,
+					Mask: net.CIDRMask(64, 128),
+				},
+			},
+			err: &net.ParseError{
+				Type: "CIDR address",
+				Text: "<nil>",
+			},
+		},
 		{
 			desc: "IPv6 address only",
 			addrs: []net.Addr{
@@ -247,6 +1187,58 @@ func (p *closeCapturePacketConn) Close() error {
 	return nil
 }
 
+// blockingReadFromPacketConn is a net.PacketConn which blocks in ReadFrom
+// until it is closed, and counts how many times it is closed
+type blockingReadFromPacketConn struct {
+	done   chan struct{}
+	closes int
+
+	noopPacketConn
+}
+
+func (p *blockingReadFromPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	<-p.done
+	return 0, nil, errors.New("socket closed")
+}
+
+func (p *blockingReadFromPacketConn) Close() error {
+	p.closes++
+	close(p.done)
+	return nil
+}
+
+// writeToCapturePacketConn is a net.PacketConn which captures the bytes
+// and address passed to its WriteTo method
+type writeToCapturePacketConn struct {
+	b    []byte
+	addr net.Addr
+
+	noopPacketConn
+}
+
+func (p *writeToCapturePacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	p.b = append([]byte(nil), b...)
+	p.addr = addr
+	return len(b), nil
+}
+
+// lockedWriteCapturePacketConn is a net.PacketConn which captures a copy
+// of every written frame, and is safe for concurrent use
+type lockedWriteCapturePacketConn struct {
+	mu     sync.Mutex
+	writes [][]byte
+
+	noopPacketConn
+}
+
+func (p *lockedWriteCapturePacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.writes = append(p.writes, append([]byte(nil), b...))
+	return len(b), nil
+}
+
 // deadlineCapturePacketConn is a net.PacketConn which captures read and
 // write deadlines
 type deadlineCapturePacketConn struct {
@@ -272,6 +1264,19 @@ func (p *deadlineCapturePacketConn) SetWriteDeadline(t time.Time) error {
 	return nil
 }
 
+// writeDeadlineCapturePacketConn is a net.PacketConn which captures the
+// write deadline in effect when its WriteTo method is called
+type writeDeadlineCapturePacketConn struct {
+	writeDeadline time.Time
+
+	deadlineCapturePacketConn
+}
+
+func (p *writeDeadlineCapturePacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	p.writeDeadline = p.w
+	return len(b), nil
+}
+
 // noopPacketConn is a net.PacketConn which simply no-ops any input. It is
 // embeded in other implementations so they do not have to implement every
 // single method
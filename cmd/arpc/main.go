@@ -19,8 +19,9 @@ var (
 	// ifaceFlag is used to set a network interface for ARP requests
 	ifaceFlag = flag.String("i", "eth0", "network interface to use for ARP request")
 
-	// ipFlag is used to set an IPv4 address destination for an ARP request
-	ipFlag = flag.String("ip", "", "IPv4 address destination for ARP request")
+	// ipFlag is used to set an IPv4 address or hostname destination for an
+	// ARP request
+	ipFlag = flag.String("ip", "", "IPv4 address or hostname destination for ARP request")
 )
 
 func main() {
@@ -44,12 +45,11 @@ func main() {
 		log.Fatal(err)
 	}
 
-	// Request MAC address for IP address
-	ip := net.ParseIP(*ipFlag).To4()
-	mac, err := c.Resolve(ip)
+	// Request MAC address for IP address or hostname
+	mac, err := c.ResolveHost(*ipFlag)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	fmt.Printf("%s -> %s", ip, mac)
+	fmt.Printf("%s -> %s", *ipFlag, mac)
 }
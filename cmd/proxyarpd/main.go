@@ -17,6 +17,10 @@ var (
 
 	// ipFlag is used to set an IPv4 address to proxy ARP on behalf of
 	ipFlag = flag.String("ip", "", "IP address for device to proxy ARP on behalf of")
+
+	// throttleFlag is used to set the window during which repeated requests
+	// from the same requester are not answered
+	throttleFlag = flag.Duration("throttle", arp.DefaultReplyThrottleWindow, "minimum time between replies to the same requester")
 )
 
 func main() {
@@ -37,10 +41,16 @@ func main() {
         log.Fatalf("coundn't create ARP client: %s", err)
     }
 
+	// Suppress replies to retransmitted requests, which also prevents reply
+	// storms with other proxies on the same segment
+	throttle := &arp.ReplyThrottle{
+		Window: *throttleFlag,
+	}
+
 	// Handle ARP requests bound for designated IPv4 address, using proxy ARP
 	// to indicate that the address belongs to this machine
     for {
-        pkt, eth, err := client.Read()
+        pkt, eth, err := client.ReadOp(arp.OperationRequest)
         if err != nil {
             if err == io.EOF {
                 log.Println("EOF")
@@ -49,17 +59,18 @@ func main() {
             log.Fatalf("error processing ARP requests: %s", err)
         }
 
-        // Ignore ARP replies
-        if pkt.Operation != arp.OperationRequest {
-            continue
-        }
-
 		// Ignore ARP requests which are not broadcast or bound directly for
 		// this machine
 		if !bytes.Equal(eth.Destination, ethernet.Broadcast) && !bytes.Equal(eth.Destination, ifi.HardwareAddr) {
 			continue
 		}
 
+		// Ignore ARP requests sent by this machine, which may be reflected
+		// back by hubs or mirror ports
+		if client.IsLocalSender(pkt) {
+			continue
+		}
+
 		log.Printf("request: who-has %s? tell %s (%s)", pkt.TargetIP, pkt.SenderIP, pkt.SenderMAC)
 
 		// Ignore ARP requests which do not indicate the target IP
@@ -67,6 +78,11 @@ func main() {
             continue
         }
 
+		if !throttle.Allow(pkt) {
+			log.Printf("  throttled: %s (%s)", pkt.SenderIP, pkt.SenderMAC)
+			continue
+		}
+
 		log.Printf("  reply: %s is-at %s", ip, ifi.HardwareAddr)
         if err := client.Reply(pkt, ifi.HardwareAddr, ip); err != nil {
 			log.Fatal(err)
@@ -0,0 +1,34 @@
+package arp
+
+//go:generate stringer -output=hardware_string.go -type=HardwareType
+
+// A HardwareType is an IANA-assigned ARP hardware type, as carried in the
+// HardwareType field of a Packet.
+type HardwareType uint16
+
+// HardwareType constants for common network media.
+const (
+	HardwareTypeUnknown    HardwareType = 0
+	HardwareTypeEthernet   HardwareType = 1
+	HardwareTypeEUI64      HardwareType = 27
+	HardwareTypeInfiniBand HardwareType = 32
+)
+
+// InferHardwareType returns the most likely HardwareType for a hardware
+// address of macLen bytes: 6 for ethernet, 8 for EUI-64, and 20 for
+// InfiniBand. HardwareTypeUnknown is returned for any other length.
+//
+// Several media share the same address length, so the result is only a
+// best guess, for use when the type of a network interface is not known.
+func InferHardwareType(macLen int) HardwareType {
+	switch macLen {
+	case 6:
+		return HardwareTypeEthernet
+	case 8:
+		return HardwareTypeEUI64
+	case 20:
+		return HardwareTypeInfiniBand
+	default:
+		return HardwareTypeUnknown
+	}
+}
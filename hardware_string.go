@@ -0,0 +1,38 @@
+// Code generated by "stringer -output=hardware_string.go -type=HardwareType"; DO NOT EDIT.
+
+package arp
+
+import "strconv"
+
+func _() {
+	// An "invalid array index" compiler error signifies that the constant values have changed.
+	// Re-run the stringer command to generate them again.
+	var x [1]struct{}
+	_ = x[HardwareTypeUnknown-0]
+	_ = x[HardwareTypeEthernet-1]
+	_ = x[HardwareTypeEUI64-27]
+	_ = x[HardwareTypeInfiniBand-32]
+}
+
+const (
+	_HardwareType_name_0 = "HardwareTypeUnknownHardwareTypeEthernet"
+	_HardwareType_name_1 = "HardwareTypeEUI64"
+	_HardwareType_name_2 = "HardwareTypeInfiniBand"
+)
+
+var (
+	_HardwareType_index_0 = [...]uint8{0, 19, 39}
+)
+
+func (i HardwareType) String() string {
+	switch {
+	case i <= 1:
+		return _HardwareType_name_0[_HardwareType_index_0[i]:_HardwareType_index_0[i+1]]
+	case i == 27:
+		return _HardwareType_name_1
+	case i == 32:
+		return _HardwareType_name_2
+	default:
+		return "HardwareType(" + strconv.FormatInt(int64(i), 10) + ")"
+	}
+}
@@ -0,0 +1,64 @@
+package arp
+
+import (
+	"testing"
+)
+
+func TestInferHardwareType(t *testing.T) {
+	var tests = []struct {
+		desc   string
+		macLen int
+		htype  HardwareType
+		s      string
+	}{
+		{
+			desc:   "ethernet",
+			macLen: 6,
+			htype:  HardwareTypeEthernet,
+			s:      "HardwareTypeEthernet",
+		},
+		{
+			desc:   "EUI-64",
+			macLen: 8,
+			htype:  HardwareTypeEUI64,
+			s:      "HardwareTypeEUI64",
+		},
+		{
+			desc:   "InfiniBand",
+			macLen: 20,
+			htype:  HardwareTypeInfiniBand,
+			s:      "HardwareTypeInfiniBand",
+		},
+		{
+			desc:   "empty address",
+			macLen: 0,
+			htype:  HardwareTypeUnknown,
+			s:      "HardwareTypeUnknown",
+		},
+		{
+			desc:   "unknown length",
+			macLen: 7,
+			htype:  HardwareTypeUnknown,
+			s:      "HardwareTypeUnknown",
+		},
+	}
+
+	for i, tt := range tests {
+		htype := InferHardwareType(tt.macLen)
+		if want, got := tt.htype, htype; want != got {
+			t.Fatalf("[%02d] test %q, unexpected HardwareType: %v != %v",
+				i, tt.desc, want, got)
+		}
+
+		if want, got := tt.s, htype.String(); want != got {
+			t.Fatalf("[%02d] test %q, unexpected string: %v != %v",
+				i, tt.desc, want, got)
+		}
+	}
+}
+
+func TestHardwareTypeStringUnknown(t *testing.T) {
+	if want, got := "HardwareType(6)", HardwareType(6).String(); want != got {
+		t.Fatalf("unexpected string: %v != %v", want, got)
+	}
+}
@@ -0,0 +1,230 @@
+package arp
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/caser789/arp/arptest"
+)
+
+// These tests connect two Clients using an in-memory link, so that packets
+// sent by one are received and parsed by the other.
+
+func TestIntegrationResolveRespond(t *testing.T) {
+	client, responder, done := testPipeClients(t)
+	defer done()
+
+	go func() {
+		_ = responder.Respond(responder.ip)
+	}()
+
+	mac, err := client.Resolve(responder.ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := responder.ifi.HardwareAddr, mac; !bytes.Equal(want, got) {
+		t.Fatalf("unexpected resolved MAC: %v != %v", want, got)
+	}
+}
+
+func TestIntegrationResolveNoResponder(t *testing.T) {
+	client, _, done := testPipeClients(t)
+	defer done()
+
+	if err := client.SetReadDeadline(time.Now().Add(50 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := client.Resolve(net.IPv4(192, 168, 1, 2))
+	if nerr, ok := err.(net.Error); !ok || !nerr.Timeout() {
+		t.Fatalf("expected timeout error, got: %v", err)
+	}
+}
+
+func TestIntegrationIsReachable(t *testing.T) {
+	client, responder, done := testPipeClients(t)
+	defer done()
+
+	go func() {
+		_ = responder.Respond(responder.ip)
+	}()
+
+	var tests = []struct {
+		desc string
+		ip   net.IP
+		ok   bool
+		mac  net.HardwareAddr
+	}{
+		{
+			desc: "responder answers",
+			ip:   responder.ip,
+			ok:   true,
+			mac:  responder.ifi.HardwareAddr,
+		},
+		{
+			desc: "no host answers",
+			ip:   net.IPv4(192, 168, 1, 3),
+		},
+	}
+
+	for i, tt := range tests {
+		ok, mac := client.IsReachable(tt.ip, 50*time.Millisecond)
+		if want, got := tt.ok, ok; want != got {
+			t.Fatalf("[%02d] test %q, unexpected reachability: %v != %v",
+				i, tt.desc, want, got)
+		}
+
+		if want, got := tt.mac, mac; !bytes.Equal(want, got) {
+			t.Fatalf("[%02d] test %q, unexpected MAC: %v != %v",
+				i, tt.desc, want, got)
+		}
+	}
+}
+
+func TestIntegrationNeighborCacheLookup(t *testing.T) {
+	client, responder, done := testPipeClients(t)
+	defer done()
+
+	go func() {
+		_ = responder.Respond(responder.ip)
+	}()
+
+	n := NewNeighborCache(client)
+	n.Start(context.Background())
+	defer n.Stop()
+
+	mac, ok := n.Lookup(responder.ip)
+	if !ok {
+		t.Fatal("expected address to be resolved")
+	}
+
+	if want, got := responder.ifi.HardwareAddr, mac; !bytes.Equal(want, got) {
+		t.Fatalf("unexpected resolved MAC: %v != %v", want, got)
+	}
+}
+
+func TestIntegrationRequestStream(t *testing.T) {
+	client, responder, done := testPipeClients(t)
+	defer done()
+
+	ips := []net.IP{
+		net.IPv4(192, 168, 1, 10),
+		net.IPv4(192, 168, 1, 11),
+		net.IPv4(192, 168, 1, 12),
+	}
+
+	go func() {
+		_ = responder.RespondComputed(LocallyAdministeredMAC)
+	}()
+
+	replies, stop := client.RequestStream(ips)
+	defer stop()
+
+	seen := make(map[string]bool)
+	for p := range replies {
+		if want, got := LocallyAdministeredMAC(p.SenderIP), p.SenderMAC; !bytes.Equal(want, got) {
+			t.Fatalf("unexpected MAC for %v: %v != %v", p.SenderIP, want, got)
+		}
+
+		seen[p.SenderIP.String()] = true
+		if len(seen) == len(ips) {
+			break
+		}
+	}
+
+	stop()
+
+	// The channel is closed once reading has stopped
+	if _, ok := <-replies; ok {
+		t.Fatal("expected replies channel to be closed")
+	}
+}
+
+func TestIntegrationScan(t *testing.T) {
+	client, responder, done := testPipeClients(t)
+	defer done()
+
+	const delay = 20 * time.Millisecond
+
+	// Reply to each request after a delay, so RTT is measurable
+	go func() {
+		for {
+			req, _, err := responder.Read()
+			if err != nil {
+				return
+			}
+
+			if req.Operation != OperationRequest || !req.TargetIP.Equal(responder.ip) {
+				continue
+			}
+
+			time.Sleep(delay)
+			if err := responder.Reply(req, responder.ifi.HardwareAddr, responder.ip); err != nil {
+				return
+			}
+		}
+	}()
+
+	ns, err := client.Scan([]net.IP{
+		responder.ip,
+		net.IPv4(192, 168, 1, 3),
+	}, 500*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := 1, len(ns); want != got {
+		t.Fatalf("unexpected number of neighbors: %v != %v", want, got)
+	}
+
+	n := ns[0]
+	if want, got := responder.ip, n.IP; !want.Equal(got) {
+		t.Fatalf("unexpected neighbor IP: %v != %v", want, got)
+	}
+	if want, got := responder.ifi.HardwareAddr, n.MAC; !bytes.Equal(want, got) {
+		t.Fatalf("unexpected neighbor MAC: %v != %v", want, got)
+	}
+	if n.RTT < delay {
+		t.Fatalf("RTT does not include reply delay: %v < %v", n.RTT, delay)
+	}
+	if n.FirstSeen.IsZero() {
+		t.Fatal("first seen time was not set")
+	}
+}
+
+// testPipeClients creates two Clients on the same IPv4 subnet, connected
+// by an arptest.PipeConn. The returned function closes both Clients.
+func testPipeClients(t *testing.T) (*Client, *Client, func()) {
+	t.Helper()
+
+	macA := net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+	macB := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	pa, pb := arptest.Pipe(macA, macB)
+
+	newPipeClient := func(name string, mac net.HardwareAddr, ip net.IP, p net.PacketConn) *Client {
+		c, err := newClient(&net.Interface{
+			Name:         name,
+			HardwareAddr: mac,
+		}, p, []net.Addr{&net.IPNet{
+			IP:   ip,
+			Mask: net.CIDRMask(24, 32),
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return c
+	}
+
+	a := newPipeClient("a0", macA, net.IPv4(192, 168, 1, 1), pa)
+	b := newPipeClient("b0", macB, net.IPv4(192, 168, 1, 2), pb)
+
+	return a, b, func() {
+		_ = a.Close()
+		_ = b.Close()
+	}
+}
@@ -0,0 +1,29 @@
+// Code generated by "stringer -output=kind_string.go -type=PacketKind"; DO NOT EDIT.
+
+package arp
+
+import "strconv"
+
+func _() {
+	// An "invalid array index" compiler error signifies that the constant values have changed.
+	// Re-run the stringer command to generate them again.
+	var x [1]struct{}
+	_ = x[KindUnknown-0]
+	_ = x[KindRequest-1]
+	_ = x[KindReply-2]
+	_ = x[KindGratuitousRequest-3]
+	_ = x[KindGratuitousReply-4]
+	_ = x[KindProbe-5]
+	_ = x[KindAnnouncement-6]
+}
+
+const _PacketKind_name = "KindUnknownKindRequestKindReplyKindGratuitousRequestKindGratuitousReplyKindProbeKindAnnouncement"
+
+var _PacketKind_index = [...]uint8{0, 11, 22, 31, 52, 71, 80, 96}
+
+func (i PacketKind) String() string {
+	if i >= PacketKind(len(_PacketKind_index)-1) {
+		return "PacketKind(" + strconv.FormatInt(int64(i), 10) + ")"
+	}
+	return _PacketKind_name[_PacketKind_index[i]:_PacketKind_index[i+1]]
+}
@@ -0,0 +1,39 @@
+package arp
+
+// A Logger receives diagnostic messages from a Client, such as when a
+// malformed packet is received or a resolution times out. *log.Logger
+// implements Logger.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// WithLogger returns an Option which sets the Logger that receives
+// diagnostic messages from a Client, in the same way as SetLogger.
+func WithLogger(l Logger) Option {
+	return func(c *Client) {
+		c.log = l
+	}
+}
+
+// SetLogger sets the Logger which receives diagnostic messages from the
+// Client, replacing any Logger set using WithLogger. If l is nil, which is
+// the default, messages are discarded.
+func (c *Client) SetLogger(l Logger) {
+	c.smu.Lock()
+	defer c.smu.Unlock()
+
+	c.log = l
+}
+
+// logf logs a diagnostic message, if a Logger is set
+func (c *Client) logf(format string, v ...interface{}) {
+	c.smu.RLock()
+	l := c.log
+	c.smu.RUnlock()
+
+	if l == nil {
+		return
+	}
+
+	l.Printf(format, v...)
+}
@@ -0,0 +1,126 @@
+package arp
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/caser789/ethernet"
+)
+
+func TestClientLoggerParseError(t *testing.T) {
+	f := &ethernet.Frame{
+		Destination: ethernet.Broadcast,
+		Source:      net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff},
+		EtherType:   ethernet.EtherTypeARP,
+		Payload:     []byte{0, 1, 2, 3},
+	}
+
+	fb, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Remove the padding added by MarshalBinary, so the ARP payload is
+	// truncated
+	fb = fb[:14+len(f.Payload)]
+
+	l := &captureLogger{}
+	c := &Client{
+		p: &frameReadFromPacketConn{
+			frames: [][]byte{fb},
+		},
+	}
+	c.SetLogger(l)
+
+	if _, _, err := c.Read(); err == nil {
+		t.Fatal("expected an error for malformed packet")
+	}
+
+	l.mustContain(t, "failed to parse packet")
+}
+
+func TestClientLoggerResolveTimeout(t *testing.T) {
+	l := &captureLogger{}
+	c := &Client{
+		ifi: &net.Interface{
+			HardwareAddr: net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+		},
+		ip: net.IPv4(192, 168, 1, 1).To4(),
+		p: &frameReadWriteCapturePacketConn{
+			frameReadFromPacketConn: frameReadFromPacketConn{
+				err: &timeoutError{},
+			},
+		},
+	}
+	c.SetLogger(l)
+
+	if _, err := c.Resolve(net.IPv4(192, 168, 1, 10)); err == nil {
+		t.Fatal("expected a timeout error")
+	}
+
+	l.mustContain(t, "timed out waiting for reply from 192.168.1.10")
+}
+
+func TestClientWithLogger(t *testing.T) {
+	addrs := []net.Addr{
+		&net.IPNet{
+			IP:   net.IPv4(192, 168, 1, 1),
+			Mask: net.CIDRMask(24, 32),
+		},
+	}
+
+	l := &captureLogger{}
+	c, err := newClient(&net.Interface{
+		HardwareAddr: net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+	}, &frameReadWriteCapturePacketConn{
+		frameReadFromPacketConn: frameReadFromPacketConn{
+			err: &timeoutError{},
+		},
+	}, addrs, WithLogger(l))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Resolve(net.IPv4(192, 168, 1, 10)); err == nil {
+		t.Fatal("expected a timeout error")
+	}
+
+	l.mustContain(t, "timed out waiting for reply from 192.168.1.10")
+}
+
+func TestClientLoggerNil(t *testing.T) {
+	c := &Client{
+		p: &frameReadFromPacketConn{
+			frames: [][]byte{{0}},
+		},
+	}
+
+	// No Logger is set by default, so messages are discarded
+	if _, _, err := c.Read(); err == nil {
+		t.Fatal("expected an error for malformed frame")
+	}
+}
+
+// captureLogger is a Logger which captures all logged messages
+type captureLogger struct {
+	msgs []string
+}
+
+func (l *captureLogger) Printf(format string, v ...interface{}) {
+	l.msgs = append(l.msgs, fmt.Sprintf(format, v...))
+}
+
+// mustContain fails the test if no logged message contains s
+func (l *captureLogger) mustContain(t *testing.T, s string) {
+	t.Helper()
+
+	for _, m := range l.msgs {
+		if strings.Contains(m, s) {
+			return
+		}
+	}
+
+	t.Fatalf("no logged message contains %q: %v", s, l.msgs)
+}
@@ -0,0 +1,35 @@
+package arp
+
+import (
+	"net"
+)
+
+// IsBroadcastMAC reports whether mac is a broadcast hardware address, in
+// which every bit is set, such as ethernet.Broadcast.
+func IsBroadcastMAC(mac net.HardwareAddr) bool {
+	if len(mac) == 0 {
+		return false
+	}
+
+	for _, b := range mac {
+		if b != 0xff {
+			return false
+		}
+	}
+
+	return true
+}
+
+// IsMulticastMAC reports whether mac is a group address, as indicated by the
+// least significant bit of its first octet. Broadcast addresses are also
+// multicast addresses.
+func IsMulticastMAC(mac net.HardwareAddr) bool {
+	return len(mac) > 0 && mac[0]&0x01 != 0
+}
+
+// IsLocallyAdministeredMAC reports whether mac is a locally administered
+// address, rather than one assigned by its manufacturer, as indicated by
+// the second least significant bit of its first octet.
+func IsLocallyAdministeredMAC(mac net.HardwareAddr) bool {
+	return len(mac) > 0 && mac[0]&0x02 != 0
+}
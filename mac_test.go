@@ -0,0 +1,64 @@
+package arp
+
+import (
+	"net"
+	"testing"
+
+	"github.com/caser789/ethernet"
+)
+
+func TestMACHelpers(t *testing.T) {
+	var tests = []struct {
+		desc      string
+		mac       net.HardwareAddr
+		broadcast bool
+		multicast bool
+		local     bool
+	}{
+		{
+			desc: "empty",
+		},
+		{
+			desc: "unicast",
+			mac:  net.HardwareAddr{0x00, 0x1b, 0x21, 0xde, 0xad, 0xbe},
+		},
+		{
+			desc:      "broadcast",
+			mac:       ethernet.Broadcast,
+			broadcast: true,
+			multicast: true,
+			local:     true,
+		},
+		{
+			desc:      "IPv4 multicast",
+			mac:       net.HardwareAddr{0x01, 0x00, 0x5e, 0x00, 0x00, 0x01},
+			multicast: true,
+		},
+		{
+			desc:  "locally administered unicast",
+			mac:   net.HardwareAddr{0x02, 0x00, 0xc0, 0xa8, 0x01, 0x0a},
+			local: true,
+		},
+		{
+			desc:      "locally administered multicast",
+			mac:       net.HardwareAddr{0x03, 0x00, 0x00, 0x00, 0x00, 0x01},
+			multicast: true,
+			local:     true,
+		},
+	}
+
+	for i, tt := range tests {
+		if want, got := tt.broadcast, IsBroadcastMAC(tt.mac); want != got {
+			t.Fatalf("[%02d] test %q, unexpected broadcast result: %v != %v",
+				i, tt.desc, want, got)
+		}
+		if want, got := tt.multicast, IsMulticastMAC(tt.mac); want != got {
+			t.Fatalf("[%02d] test %q, unexpected multicast result: %v != %v",
+				i, tt.desc, want, got)
+		}
+		if want, got := tt.local, IsLocallyAdministeredMAC(tt.mac); want != got {
+			t.Fatalf("[%02d] test %q, unexpected locally administered result: %v != %v",
+				i, tt.desc, want, got)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package arp
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/caser789/ethernet"
+)
+
+// DefaultReplyMonitorTTL is the default amount of time a ReplyMonitor
+// considers a request outstanding after it was sent
+const DefaultReplyMonitorTTL = 5 * time.Second
+
+// A ReplyMonitor detects unsolicited ARP replies: replies for an IPv4
+// address which the local host has not recently requested. Unsolicited
+// replies are a common sign of ARP cache poisoning.
+//
+// A ReplyMonitor learns which addresses were requested from requests sent
+// using its Request method, and from requests it observes which were sent
+// from the Client's own hardware address, such as those sent by the
+// operating system.
+//
+// While a ReplyMonitor is running, it owns the read side of its Client,
+// and the Client's Read and Resolve methods must not be used.
+type ReplyMonitor struct {
+	// TTL specifies how long a request remains outstanding after it was
+	// sent or observed. Replies for its target address received within
+	// TTL are considered solicited. If zero, DefaultReplyMonitorTTL is
+	// used.
+	TTL time.Duration
+
+	c *Client
+
+	mu          sync.Mutex
+	pending     map[string]time.Time
+	unsolicited func(p *Packet)
+
+	bg background
+
+	// now is used to retrieve the current time, so tests can control
+	// request expiration
+	now func() time.Time
+}
+
+// NewReplyMonitor creates a new ReplyMonitor which inspects ARP packets
+// received by c.
+func NewReplyMonitor(c *Client) *ReplyMonitor {
+	return &ReplyMonitor{
+		c:       c,
+		pending: make(map[string]time.Time),
+		now:     time.Now,
+	}
+}
+
+// OnUnsolicited sets fn to be called for each unsolicited reply observed
+// by the ReplyMonitor. fn is called from the ReplyMonitor's background
+// reader, and should not block.
+func (m *ReplyMonitor) OnUnsolicited(fn func(p *Packet)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.unsolicited = fn
+}
+
+// Request sends an ARP request for ip using the ReplyMonitor's Client, and
+// records ip as outstanding so that replies for it are not flagged.
+func (m *ReplyMonitor) Request(ip net.IP) error {
+	// Record the request before sending it, so a fast reply is not
+	// flagged
+	m.solicit(ip)
+	return m.c.Request(ip)
+}
+
+// Start begins reading ARP packets from the ReplyMonitor's Client in the
+// background. Reading continues until ctx is canceled, Stop is called, or
+// the Client returns an error.
+func (m *ReplyMonitor) Start(ctx context.Context) {
+	m.bg.start(ctx, m.monitor)
+}
+
+// Stop stops a ReplyMonitor which was started using Start, and waits for
+// its background reader to exit. Stop returns the error which caused the
+// background reader to exit, if any.
+func (m *ReplyMonitor) Stop() error {
+	return m.bg.stop()
+}
+
+// monitor reads ARP packets until ctx is canceled or an error occurs,
+// checking each for unsolicited replies
+func (m *ReplyMonitor) monitor(ctx context.Context) error {
+	return readUntil(ctx, m.c, func(p *Packet, _ *ethernet.Frame) error {
+		m.observe(p)
+		return nil
+	})
+}
+
+// observe records outstanding requests sent by the local host, and reports
+// replies which were not solicited by one
+func (m *ReplyMonitor) observe(p *Packet) {
+	switch p.Operation {
+	case OperationRequest:
+		if m.c.IsLocalSender(p) {
+			m.solicit(p.TargetIP)
+		}
+	case OperationReply:
+		m.mu.Lock()
+		fn := m.unsolicited
+		ok := m.solicited(p.SenderIP)
+		m.mu.Unlock()
+
+		if !ok && fn != nil {
+			fn(p)
+		}
+	}
+}
+
+// solicit records ip as the target of an outstanding request
+func (m *ReplyMonitor) solicit(ip net.IP) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.pending[ip.String()] = m.now()
+}
+
+// solicited reports whether a request for ip is outstanding, removing any
+// expired requests. m.mu must be held when calling solicited.
+func (m *ReplyMonitor) solicited(ip net.IP) bool {
+	now := m.now()
+	for k, sent := range m.pending {
+		if now.Sub(sent) >= m.ttl() {
+			delete(m.pending, k)
+		}
+	}
+
+	_, ok := m.pending[ip.String()]
+	return ok
+}
+
+// ttl returns the configured TTL, or the default if none is set
+func (m *ReplyMonitor) ttl() time.Duration {
+	if m.TTL == 0 {
+		return DefaultReplyMonitorTTL
+	}
+
+	return m.TTL
+}
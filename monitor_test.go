@@ -0,0 +1,113 @@
+package arp
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestReplyMonitorUnsolicited(t *testing.T) {
+	clientMAC := net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+	clientIP := net.IPv4(192, 168, 1, 1)
+
+	p := newChanReadFromPacketConn()
+	m := NewReplyMonitor(&Client{
+		ifi: &net.Interface{
+			HardwareAddr: clientMAC,
+		},
+		ip: clientIP.To4(),
+		p:  p,
+	})
+
+	flagged := make(chan *Packet, 2)
+	m.OnUnsolicited(func(p *Packet) {
+		flagged <- p
+	})
+
+	m.Start(context.Background())
+
+	solicited := net.IPv4(192, 168, 1, 10)
+	if err := m.Request(solicited); err != nil {
+		t.Fatal(err)
+	}
+
+	peerMAC := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	unsolicited := net.IPv4(192, 168, 1, 254)
+	p.frames <- mustARPFrame(t, OperationReply, peerMAC, solicited, clientMAC, clientIP)
+	p.frames <- mustARPFrame(t, OperationReply, peerMAC, unsolicited, clientMAC, clientIP)
+
+	select {
+	case got := <-flagged:
+		if want := unsolicited; !want.Equal(got.SenderIP) {
+			t.Fatalf("unexpected unsolicited reply sender IP: %v != %v", want, got.SenderIP)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for unsolicited reply")
+	}
+
+	if err := m.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := 0, len(flagged); want != got {
+		t.Fatalf("unexpected number of additional flagged replies: %v != %v", want, got)
+	}
+
+	// The monitored Client remains usable once the monitor is stopped
+	testClientReadsAfterStop(t, m.c, p)
+}
+
+func TestReplyMonitorObserve(t *testing.T) {
+	clientMAC := net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+	clientIP := net.IPv4(192, 168, 1, 1)
+	peerMAC := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	peerIP := net.IPv4(192, 168, 1, 10)
+
+	now := time.Now()
+	m := NewReplyMonitor(&Client{
+		ifi: &net.Interface{
+			HardwareAddr: clientMAC,
+		},
+	})
+	m.TTL = time.Second
+	m.now = func() time.Time { return now }
+
+	var flagged int
+	m.OnUnsolicited(func(_ *Packet) {
+		flagged++
+	})
+
+	mustPacket := func(op Operation, srcMAC net.HardwareAddr, srcIP net.IP, dstMAC net.HardwareAddr, dstIP net.IP) *Packet {
+		p, err := NewPacket(op, srcMAC, srcIP, dstMAC, dstIP)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return p
+	}
+
+	reply := mustPacket(OperationReply, peerMAC, peerIP, clientMAC, clientIP)
+
+	// A request from another host does not solicit replies for the
+	// local host
+	m.observe(mustPacket(OperationRequest, peerMAC, net.IPv4(192, 168, 1, 20), clientMAC, peerIP))
+	m.observe(reply)
+	if want, got := 1, flagged; want != got {
+		t.Fatalf("unexpected number of flagged replies: %v != %v", want, got)
+	}
+
+	// A request observed from the local host solicits replies until TTL
+	// elapses
+	m.observe(mustPacket(OperationRequest, clientMAC, clientIP, clientMAC, peerIP))
+	m.observe(reply)
+	if want, got := 1, flagged; want != got {
+		t.Fatalf("unexpected number of flagged replies: %v != %v", want, got)
+	}
+
+	now = now.Add(2 * time.Second)
+	m.observe(reply)
+	if want, got := 2, flagged; want != got {
+		t.Fatalf("unexpected number of flagged replies after expiry: %v != %v", want, got)
+	}
+}
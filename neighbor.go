@@ -0,0 +1,242 @@
+package arp
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/caser789/ethernet"
+)
+
+const (
+	// DefaultNeighborTTL is the default amount of time an entry remains
+	// valid in a NeighborCache after it was last confirmed by traffic
+	DefaultNeighborTTL = 5 * time.Minute
+
+	// DefaultNeighborResolveTimeout is the default amount of time a
+	// NeighborCache waits for a reply when Lookup misses the cache
+	DefaultNeighborResolveTimeout = 1 * time.Second
+)
+
+// A NeighborCache is a cache of IPv4 address to hardware address
+// mappings, similar to an operating system's neighbor table. Once started,
+// a NeighborCache reads every ARP packet received by its Client and
+// records the sender's addresses.
+//
+// Like an operating system's neighbor table, a NeighborCache trusts
+// announcements over passively observed traffic: a valid entry learned
+// from an announcement is not replaced by a different hardware address
+// observed in an ordinary request or reply.
+//
+// While a NeighborCache is running, it owns the read side of its Client,
+// and the Client's Read and Resolve methods must not be used.
+type NeighborCache struct {
+	// TTL specifies how long an entry remains valid after it was last
+	// confirmed by observed traffic. If zero, DefaultNeighborTTL is used.
+	TTL time.Duration
+
+	// ResolveTimeout specifies how long Lookup waits for a reply after
+	// sending an ARP request on a cache miss. If zero,
+	// DefaultNeighborResolveTimeout is used.
+	ResolveTimeout time.Duration
+
+	c *Client
+
+	mu      sync.Mutex
+	entries map[string]neighborEntry
+	waiters map[string][]chan neighborEntry
+
+	bg background
+
+	// now is used to retrieve the current time, so tests can control
+	// entry expiration
+	now func() time.Time
+}
+
+// A Confidence indicates how trustworthy a NeighborCache entry is, based on
+// the kind of packet it was learned from.
+type Confidence int
+
+// Confidence levels of NeighborCache entries, in increasing order of trust.
+const (
+	// ConfidenceObserved indicates an entry learned passively from the
+	// sender addresses of an ARP request or reply.
+	ConfidenceObserved Confidence = iota + 1
+
+	// ConfidenceAnnounced indicates an entry learned from an ARP
+	// announcement or other gratuitous packet, in which a host asserts
+	// ownership of its own address.
+	ConfidenceAnnounced
+)
+
+// neighborEntry is a single entry in a NeighborCache
+type neighborEntry struct {
+	mac  net.HardwareAddr
+	seen time.Time
+	conf Confidence
+}
+
+// NewNeighborCache creates a new NeighborCache which learns addresses from
+// ARP packets received by c.
+func NewNeighborCache(c *Client) *NeighborCache {
+	return &NeighborCache{
+		c:       c,
+		entries: make(map[string]neighborEntry),
+		waiters: make(map[string][]chan neighborEntry),
+		now:     time.Now,
+	}
+}
+
+// Start begins reading ARP packets from the NeighborCache's Client in the
+// background, recording each sender's addresses. Reading continues until
+// ctx is canceled, Stop is called, or the Client returns an error.
+func (n *NeighborCache) Start(ctx context.Context) {
+	n.bg.start(ctx, n.sniff)
+}
+
+// Stop stops a NeighborCache which was started using Start, and waits for
+// its background reader to exit. Stop returns the error which caused the
+// background reader to exit, if any.
+func (n *NeighborCache) Stop() error {
+	return n.bg.stop()
+}
+
+// Lookup retrieves the hardware address associated with ip.
+//
+// If no valid entry is cached, Lookup sends an ARP request for ip and waits
+// up to ResolveTimeout for the NeighborCache to observe a reply. If no
+// reply is observed, Lookup returns false.
+func (n *NeighborCache) Lookup(ip net.IP) (net.HardwareAddr, bool) {
+	mac, _, ok := n.LookupConfidence(ip)
+	return mac, ok
+}
+
+// LookupConfidence retrieves the hardware address associated with ip in
+// the same way as Lookup, and also returns the Confidence of the entry.
+func (n *NeighborCache) LookupConfidence(ip net.IP) (net.HardwareAddr, Confidence, bool) {
+	key := ip.String()
+
+	n.mu.Lock()
+	if e, ok := n.entries[key]; ok {
+		if n.now().Sub(e.seen) < n.ttl() {
+			n.mu.Unlock()
+			return e.mac, e.conf, true
+		}
+
+		delete(n.entries, key)
+	}
+
+	// Register interest in ip before sending a request, so a fast reply
+	// is not missed
+	ch := make(chan neighborEntry, 1)
+	n.waiters[key] = append(n.waiters[key], ch)
+	n.mu.Unlock()
+
+	defer n.removeWaiter(key, ch)
+
+	if err := n.c.Request(ip); err != nil {
+		return nil, 0, false
+	}
+
+	timeout := n.ResolveTimeout
+	if timeout == 0 {
+		timeout = DefaultNeighborResolveTimeout
+	}
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+
+	select {
+	case e := <-ch:
+		return e.mac, e.conf, true
+	case <-t.C:
+		return nil, 0, false
+	}
+}
+
+// sniff reads ARP packets until ctx is canceled or an error occurs,
+// recording each sender's addresses
+func (n *NeighborCache) sniff(ctx context.Context) error {
+	return readUntil(ctx, n.c, func(p *Packet, _ *ethernet.Frame) error {
+		// Packets from hosts which do not yet have an address, such as
+		// probes, carry no useful binding
+		if p.SenderIP.Equal(net.IPv4zero) {
+			return nil
+		}
+
+		// Announcements are authoritative, since the sender asserts
+		// ownership of its own address
+		conf := ConfidenceObserved
+		if p.SenderIP.Equal(p.TargetIP) {
+			conf = ConfidenceAnnounced
+		}
+
+		n.record(p.SenderIP, p.SenderMAC, conf)
+		return nil
+	})
+}
+
+// record stores or refreshes an entry, and notifies any callers of Lookup
+// waiting for it. A valid entry is not replaced by a different hardware
+// address learned with a lower confidence.
+func (n *NeighborCache) record(ip net.IP, mac net.HardwareAddr, conf Confidence) {
+	key := ip.String()
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	now := n.now()
+	if e, ok := n.entries[key]; ok && now.Sub(e.seen) < n.ttl() && conf < e.conf {
+		if !bytes.Equal(e.mac, mac) {
+			return
+		}
+
+		// The same binding confirms the entry without lowering its
+		// confidence
+		conf = e.conf
+	}
+
+	e := neighborEntry{
+		mac:  mac,
+		seen: now,
+		conf: conf,
+	}
+	n.entries[key] = e
+
+	for _, ch := range n.waiters[key] {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+	delete(n.waiters, key)
+}
+
+// removeWaiter removes ch from the waiters for key, if it is still present
+func (n *NeighborCache) removeWaiter(key string, ch chan neighborEntry) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	ws := n.waiters[key]
+	for i, w := range ws {
+		if w == ch {
+			n.waiters[key] = append(ws[:i], ws[i+1:]...)
+			break
+		}
+	}
+
+	if len(n.waiters[key]) == 0 {
+		delete(n.waiters, key)
+	}
+}
+
+// ttl returns the configured TTL, or the default if none is set
+func (n *NeighborCache) ttl() time.Duration {
+	if n.TTL == 0 {
+		return DefaultNeighborTTL
+	}
+
+	return n.TTL
+}
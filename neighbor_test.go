@@ -0,0 +1,317 @@
+package arp
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/caser789/ethernet"
+)
+
+func TestNeighborCacheLookupLearned(t *testing.T) {
+	p := newChanReadFromPacketConn()
+	n := NewNeighborCache(&Client{
+		ifi: &net.Interface{
+			HardwareAddr: net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+		},
+		ip: net.IPv4(192, 168, 1, 1).To4(),
+		p:  p,
+	})
+
+	n.Start(context.Background())
+
+	mac := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	ip := net.IPv4(192, 168, 1, 10)
+	p.frames <- mustARPFrame(t, OperationRequest, mac, ip, ethernet.Broadcast, net.IPv4(192, 168, 1, 1))
+
+	// Lookup sends a request and waits for the reply to be observed,
+	// which may arrive before or after the request is sent
+	got, ok := n.Lookup(ip)
+	if !ok {
+		t.Fatal("expected address to be learned")
+	}
+	if want := mac; !bytes.Equal(want, got) {
+		t.Fatalf("unexpected MAC address: %v != %v", want, got)
+	}
+
+	if err := n.Stop(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNeighborCacheLookupExpired(t *testing.T) {
+	now := time.Now()
+	n := NewNeighborCache(&Client{
+		ifi: &net.Interface{
+			HardwareAddr: net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+		},
+		ip: net.IPv4(192, 168, 1, 1).To4(),
+		p:  &noopPacketConn{},
+	})
+	n.TTL = time.Minute
+	n.ResolveTimeout = 10 * time.Millisecond
+	n.now = func() time.Time { return now }
+
+	mac := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	ip := net.IPv4(192, 168, 1, 10)
+	n.record(ip, mac, ConfidenceObserved)
+
+	if _, ok := n.Lookup(ip); !ok {
+		t.Fatal("expected cached address")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, ok := n.Lookup(ip); ok {
+		t.Fatal("expected cached address to expire")
+	}
+}
+
+func TestNeighborCacheConfidence(t *testing.T) {
+	now := time.Now()
+	n := NewNeighborCache(&Client{
+		ifi: &net.Interface{
+			HardwareAddr: net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+		},
+		ip: net.IPv4(192, 168, 1, 1).To4(),
+		p:  &noopPacketConn{},
+	})
+	n.TTL = time.Minute
+	n.ResolveTimeout = 10 * time.Millisecond
+	n.now = func() time.Time { return now }
+
+	ip := net.IPv4(192, 168, 1, 10)
+	oldMAC := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x01}
+	newMAC := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x02}
+
+	var tests = []struct {
+		desc string
+		mac  net.HardwareAddr
+		conf Confidence
+		want net.HardwareAddr
+		wc   Confidence
+	}{
+		{
+			desc: "observed binding",
+			mac:  oldMAC,
+			conf: ConfidenceObserved,
+			want: oldMAC,
+			wc:   ConfidenceObserved,
+		},
+		{
+			desc: "announcement overwrites observed binding",
+			mac:  newMAC,
+			conf: ConfidenceAnnounced,
+			want: newMAC,
+			wc:   ConfidenceAnnounced,
+		},
+		{
+			desc: "observed binding does not overwrite announcement",
+			mac:  oldMAC,
+			conf: ConfidenceObserved,
+			want: newMAC,
+			wc:   ConfidenceAnnounced,
+		},
+		{
+			desc: "observed binding confirms announcement",
+			mac:  newMAC,
+			conf: ConfidenceObserved,
+			want: newMAC,
+			wc:   ConfidenceAnnounced,
+		},
+	}
+
+	for i, tt := range tests {
+		n.record(ip, tt.mac, tt.conf)
+
+		mac, conf, ok := n.LookupConfidence(ip)
+		if !ok {
+			t.Fatalf("[%02d] test %q, expected cached address", i, tt.desc)
+		}
+
+		if want, got := tt.want, mac; !bytes.Equal(want, got) {
+			t.Fatalf("[%02d] test %q, unexpected MAC address: %v != %v",
+				i, tt.desc, want, got)
+		}
+		if want, got := tt.wc, conf; want != got {
+			t.Fatalf("[%02d] test %q, unexpected confidence: %v != %v",
+				i, tt.desc, want, got)
+		}
+	}
+
+	// Once the announcement expires, an observed binding is accepted
+	now = now.Add(2 * time.Minute)
+	n.record(ip, oldMAC, ConfidenceObserved)
+
+	mac, conf, ok := n.LookupConfidence(ip)
+	if !ok || !bytes.Equal(oldMAC, mac) || conf != ConfidenceObserved {
+		t.Fatalf("unexpected entry after expiry: %v, %v, %v", mac, conf, ok)
+	}
+}
+
+func TestNeighborCacheLearnsAnnouncement(t *testing.T) {
+	p := newChanReadFromPacketConn()
+	n := NewNeighborCache(&Client{
+		ifi: &net.Interface{
+			HardwareAddr: net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+		},
+		ip: net.IPv4(192, 168, 1, 1).To4(),
+		p:  p,
+	})
+
+	n.Start(context.Background())
+
+	mac := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	ip := net.IPv4(192, 168, 1, 10)
+	p.frames <- mustARPFrame(t, OperationRequest, mac, ip, ethernet.Broadcast, ip)
+
+	got, conf, ok := n.LookupConfidence(ip)
+	if !ok {
+		t.Fatal("expected address to be learned")
+	}
+	if want := mac; !bytes.Equal(want, got) {
+		t.Fatalf("unexpected MAC address: %v != %v", want, got)
+	}
+	if want, got := ConfidenceAnnounced, conf; want != got {
+		t.Fatalf("unexpected confidence: %v != %v", want, got)
+	}
+
+	if err := n.Stop(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNeighborCacheStopUnblocksRead(t *testing.T) {
+	p := newChanReadFromPacketConn()
+	c := &Client{p: p}
+	n := NewNeighborCache(c)
+
+	n.Start(context.Background())
+	if err := n.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The read deadline used to unblock the cache must not affect later
+	// reads
+	testClientReadsAfterStop(t, c, p)
+}
+
+// testClientReadsAfterStop verifies that c can still read a packet after a
+// background reader using c has been stopped
+func testClientReadsAfterStop(t *testing.T, c *Client, p *chanReadFromPacketConn) {
+	t.Helper()
+
+	mac := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	ip := net.IPv4(192, 168, 1, 10)
+	p.frames <- mustARPFrame(t, OperationRequest, mac, ip, ethernet.Broadcast, net.IPv4(192, 168, 1, 1))
+
+	got, _, err := c.Read()
+	if err != nil {
+		t.Fatalf("failed to read after stop: %v", err)
+	}
+	if want := ip; !want.Equal(got.SenderIP) {
+		t.Fatalf("unexpected sender IP: %v != %v", want, got.SenderIP)
+	}
+}
+
+// mustARPFrame creates an ARP packet and marshals it into an ethernet
+// frame addressed to dstMAC
+func mustARPFrame(t *testing.T, op Operation, srcMAC net.HardwareAddr, srcIP net.IP, dstMAC net.HardwareAddr, dstIP net.IP) []byte {
+	t.Helper()
+
+	p, err := NewPacket(op, srcMAC, srcIP, dstMAC, dstIP)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pb, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &ethernet.Frame{
+		Destination: dstMAC,
+		Source:      srcMAC,
+		EtherType:   ethernet.EtherTypeARP,
+		Payload:     pb,
+	}
+
+	fb, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fb
+}
+
+// chanReadFromPacketConn is a net.PacketConn which blocks in ReadFrom until
+// a frame is sent on its frames channel, or until a read deadline which
+// has already passed is set. Clearing the read deadline, or setting one in
+// the future, allows ReadFrom to block again. Each call to ReadFrom is
+// signaled on its reads channel, if there is room.
+type chanReadFromPacketConn struct {
+	frames chan []byte
+	reads  chan struct{}
+
+	mu       sync.Mutex
+	wake     chan struct{}
+	deadline time.Time
+
+	noopPacketConn
+}
+
+func newChanReadFromPacketConn() *chanReadFromPacketConn {
+	return &chanReadFromPacketConn{
+		frames: make(chan []byte, 16),
+		reads:  make(chan struct{}, 16),
+		wake:   make(chan struct{}),
+	}
+}
+
+func (p *chanReadFromPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	p.mu.Lock()
+	wake := p.wake
+	p.mu.Unlock()
+
+	select {
+	case p.reads <- struct{}{}:
+	default:
+	}
+
+	select {
+	case f := <-p.frames:
+		return copy(b, f), nil, nil
+	case <-wake:
+		return 0, nil, &timeoutError{}
+	}
+}
+
+func (p *chanReadFromPacketConn) SetReadDeadline(t time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.deadline = t
+	expired := !t.IsZero() && !t.After(time.Now())
+
+	select {
+	case <-p.wake:
+		if !expired {
+			p.wake = make(chan struct{})
+		}
+	default:
+		if expired {
+			close(p.wake)
+		}
+	}
+
+	return nil
+}
+
+// timeoutError is a net.Error which indicates a timeout
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
@@ -3,9 +3,13 @@ package arp
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
 	"net"
+	"strconv"
+	"strings"
 
 	"github.com/caser789/ethernet"
 )
@@ -19,11 +23,120 @@ var (
 	// passed to NewPacket
 	ErrInvalidIP = errors.New("invalid IPv4 address")
 
+	// ErrAddressTooLong is returned when a Packet's hardware or protocol
+	// address length exceeds MaxMACLength or MaxIPLength
+	ErrAddressTooLong = errors.New("address length too long")
+
+	// ErrInvalidOperation is returned when an Operation is not one of the
+	// known ARP operations
+	ErrInvalidOperation = errors.New("invalid ARP operation")
+
+	// ErrTruncatedARP is returned, wrapped in a *DecodeError, when an
+	// ethernet frame has an ARP EtherType, but its payload is too short to
+	// contain the fixed length ARP header. This distinguishes malformed
+	// ARP traffic from frames which do not carry ARP at all
+	ErrTruncatedARP = errors.New("truncated ARP packet")
+
+	// ErrInvalidSenderMAC is returned by Packet.ValidateStrict when a
+	// Packet's sender hardware address is a multicast or broadcast
+	// address
+	ErrInvalidSenderMAC = errors.New("ARP sender hardware address is not unicast")
+
+	// ErrInvalidPacketText is returned, wrapped with the offending line
+	// number, when ParsePacketText cannot parse its input
+	ErrInvalidPacketText = errors.New("invalid ARP packet text")
+
 	// errInvalidARPPacket is returned when an ethernet frame does not
 	// indicate that an ARP packet is contained in its payload
 	errInvalidARPPacket = errors.New("invalid ARP packet")
 )
 
+// A NotARPError is returned by Client.ReadStrict and ParsePacket when an
+// ethernet frame which does not contain an ARP packet is received.
+type NotARPError struct {
+	// Frame is the ethernet frame which was received
+	Frame *ethernet.Frame
+}
+
+// Error implements error.
+func (e *NotARPError) Error() string {
+	return "received non-ARP frame with EtherType " + e.Frame.EtherType.String()
+}
+
+// decodeSnippetLen is the maximum number of input bytes included in a
+// DecodeError's snippet
+const decodeSnippetLen = 16
+
+// A DecodeError is returned when a Packet, or the ethernet frame carrying
+// it, cannot be decoded. A DecodeError wraps the underlying error, such as
+// io.ErrUnexpectedEOF or ErrAddressTooLong, so it can be checked using
+// errors.Is.
+type DecodeError struct {
+	// Offset is the byte offset of the field which could not be decoded.
+	// For errors returned by Packet.UnmarshalBinary, it is relative to the
+	// start of the ARP packet. For errors returned while reading from a
+	// Client, it is relative to the start of the ethernet frame.
+	Offset int
+
+	// Snippet is a hex encoded copy of the leading bytes of the input
+	Snippet string
+
+	// Err is the underlying error
+	Err error
+}
+
+// newDecodeError creates a DecodeError for input b
+func newDecodeError(b []byte, offset int, err error) *DecodeError {
+	snippet := b
+	if len(snippet) > decodeSnippetLen {
+		snippet = snippet[:decodeSnippetLen]
+	}
+
+	return &DecodeError{
+		Offset:  offset,
+		Snippet: hex.EncodeToString(snippet),
+		Err:     err,
+	}
+}
+
+// Error implements error.
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("failed to decode ARP data at offset %d: %v (data: %s)",
+		e.Offset, e.Err, e.Snippet)
+}
+
+// Unwrap returns the underlying error.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Maximum address lengths accepted when marshaling, unmarshaling, or
+// validating a Packet. The defaults cover the 20 byte hardware addresses
+// used by InfiniBand, and 16 byte protocol addresses. They may be raised
+// by callers which need to handle more unusual packets, up to the 255 byte
+// limit of the length fields.
+var (
+	MaxMACLength = 20
+	MaxIPLength  = 16
+)
+
+// Bounds on the length of an ARP packet in its binary form, excluding its
+// ethernet frame.
+const (
+	// MaxPacketLen is the length of the largest possible ARP packet, which
+	// uses 255 byte hardware and protocol addresses, the limit of the
+	// length fields. No call to UnmarshalBinary allocates more than this.
+	MaxPacketLen = 8 + (2 * 255) + (2 * 255)
+
+	// MinPacketLen is the length of an ARP packet for IPv4 over ethernet,
+	// with 6 byte hardware addresses and 4 byte protocol addresses.
+	MinPacketLen = 8 + (2 * 6) + (2 * 4)
+)
+
+// minEthernetPayloadLen is the minimum length of an ethernet frame's
+// payload, used by MarshalBinaryPadded when no minimum is specified
+const minEthernetPayloadLen = 46
+
 //go:generate stringer -output=string.go -type=Operation
 
 // An Operation is an ARP operation, such as request or reply.
@@ -35,6 +148,77 @@ const (
 	OperationReply   Operation = 2
 )
 
+// operationNames maps lower case names to known Operations. Both the short
+// name and the full constant name are accepted
+var operationNames = map[string]Operation{
+	"request":          OperationRequest,
+	"operationrequest": OperationRequest,
+	"reply":            OperationReply,
+	"operationreply":   OperationReply,
+}
+
+// MarshalText implements encoding.TextMarshaler, returning the name of the
+// Operation. Operations without a name, such as the RARP operations 3 and
+// 4, are returned in decimal form.
+func (o Operation) MarshalText() ([]byte, error) {
+	if _, ok := operationNames[strings.ToLower(o.String())]; !ok {
+		return []byte(strconv.Itoa(int(o))), nil
+	}
+
+	return []byte(o.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, parsing the name of an
+// Operation. Names are case-insensitive, and may be either the short form
+// (such as "request") or the full constant name (such as "OperationRequest").
+// Any Operation may also be given in decimal form.
+//
+// If b is neither the name of a known Operation nor a decimal number which
+// fits in an Operation, ErrInvalidOperation is returned.
+func (o *Operation) UnmarshalText(b []byte) error {
+	if op, ok := operationNames[strings.ToLower(string(b))]; ok {
+		*o = op
+		return nil
+	}
+
+	n, err := strconv.ParseUint(string(b), 10, 16)
+	if err != nil {
+		return ErrInvalidOperation
+	}
+
+	*o = Operation(n)
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler, encoding the Operation as a JSON
+// number. This keeps the JSON form of Packet unchanged by MarshalText,
+// which would otherwise encode the Operation as a string.
+func (o Operation) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Itoa(int(o))), nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler, decoding an Operation from a
+// JSON number. An Operation encoded as a JSON string is parsed using
+// UnmarshalText.
+func (o *Operation) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		s, err := strconv.Unquote(string(b))
+		if err != nil {
+			return ErrInvalidOperation
+		}
+
+		return o.UnmarshalText([]byte(s))
+	}
+
+	n, err := strconv.ParseUint(string(b), 10, 16)
+	if err != nil {
+		return ErrInvalidOperation
+	}
+
+	*o = Operation(n)
+	return nil
+}
+
 // A Packet is a raw ARP packet, as descripbed in RFC 826
 type Packet struct {
 	// HardwareType specifies an IANA-assigned hardware type, as described
@@ -60,13 +244,17 @@ type Packet struct {
 	// SenderMAC specifies the MAC address of the sender of this packet
 	SenderMAC net.HardwareAddr
 
-	// SenderIP specifies the IPv4 address of the sender of this Packet
+	// SenderIP specifies the IPv4 address of the sender of this Packet.
+	// When IPLength is 4, decoded and constructed packets always store
+	// a 4-byte address.
 	SenderIP net.IP
 
 	// TargetMAC specifies the MAC address of the target of this packet
 	TargetMAC net.HardwareAddr
 
-	// TargetIP specifies the IPv4 address of the target of this Packet
+	// TargetIP specifies the IPv4 address of the target of this Packet.
+	// When IPLength is 4, decoded and constructed packets always store
+	// a 4-byte address.
 	TargetIP net.IP
 }
 
@@ -120,8 +308,265 @@ func NewPacket(op Operation, srcMAC net.HardwareAddr, srcIP net.IP, dstMAC net.H
 	}, nil
 }
 
-// MarshalBinary allocates a byte slice containing the data from a Packet
+// Validate checks that a Packet's hardware and protocol address lengths do
+// not exceed MaxMACLength and MaxIPLength. If either does, ErrAddressTooLong
+// is returned.
+func (p *Packet) Validate() error {
+	return validateLengths(p.MACLength, p.IPLength)
+}
+
+// ValidateStrict checks a Packet in the same way as Validate, and also
+// checks that its sender hardware address is a unicast address. A host can
+// only send from a unicast address, so a multicast or broadcast sender is
+// malformed, and often indicates a spoofed packet. If the sender hardware
+// address is not unicast, ErrInvalidSenderMAC is returned.
+func (p *Packet) ValidateStrict() error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
+	if IsMulticastMAC(p.SenderMAC) {
+		return ErrInvalidSenderMAC
+	}
+
+	return nil
+}
+
+// validateLengths checks hardware and protocol address lengths against
+// MaxMACLength and MaxIPLength
+func validateLengths(ml uint8, il uint8) error {
+	if int(ml) > MaxMACLength || int(il) > MaxIPLength {
+		return ErrAddressTooLong
+	}
+
+	return nil
+}
+
+// NewReplyFor creates a new reply Packet for the request req, without
+// sending it. The reply's sender addresses are set to senderMAC and
+// senderIP, and its target addresses are set to the sender addresses of
+// req.
+//
+// The reply echoes the HardwareType and ProtocolType of req, so replies to
+// requests on other media, such as InfiniBand, are consistent with the
+// request. Since the reply's target addresses are those of req, its address
+// lengths also match req.
+//
+// NewReplyFor validates its addresses in the same way as NewPacket, and
+// returns the same errors.
+func NewReplyFor(req *Packet, senderMAC net.HardwareAddr, senderIP net.IP) (*Packet, error) {
+	p, err := NewPacket(OperationReply, senderMAC, senderIP, req.SenderMAC, req.SenderIP)
+	if err != nil {
+		return nil, err
+	}
+
+	p.HardwareType = req.HardwareType
+	p.ProtocolType = req.ProtocolType
+
+	return p, nil
+}
+
+// NewProbePacket creates a new RFC 5227 ARP probe Packet, which asks if any
+// host is using the IPv4 address target. A probe has an all-zero sender
+// IPv4 address, so that it does not pollute other hosts' ARP caches, and an
+// all-zero target hardware address. Probes should be sent to the ethernet
+// broadcast address.
+//
+// If srcMAC is less than 6 bytes in length, ErrInvalidMAC is returned. If
+// target is not an IPv4 address, ErrInvalidIP is returned.
+func NewProbePacket(srcMAC net.HardwareAddr, target net.IP) (*Packet, error) {
+	return NewPacket(
+		OperationRequest,
+		srcMAC,
+		net.IPv4zero,
+		make(net.HardwareAddr, len(srcMAC)),
+		target,
+	)
+}
+
+// NewAnnouncementPacket creates a new RFC 5227 ARP announcement Packet,
+// which claims the IPv4 address ip for srcMAC. An announcement is an ARP
+// request with equal sender and target IPv4 addresses, and an all-zero
+// target hardware address. Announcements should be sent to the ethernet
+// broadcast address.
+//
+// If srcMAC is less than 6 bytes in length, ErrInvalidMAC is returned. If
+// ip is not an IPv4 address, ErrInvalidIP is returned.
+func NewAnnouncementPacket(srcMAC net.HardwareAddr, ip net.IP) (*Packet, error) {
+	return NewPacket(
+		OperationRequest,
+		srcMAC,
+		ip,
+		make(net.HardwareAddr, len(srcMAC)),
+		ip,
+	)
+}
+
+// NewGratuitousPacket creates a new gratuitous ARP Packet, in which the
+// sender and target IPv4 addresses are both ip, announcing that ip is in use
+// by mac. op must be OperationRequest, in which case the target hardware
+// address is the ethernet broadcast address, or OperationReply, in which
+// case the target hardware address is mac.
+//
+// If op is not OperationRequest or OperationReply, ErrInvalidOperation is
+// returned. Addresses are validated in the same way as NewPacket, and the
+// same errors are returned.
+func NewGratuitousPacket(mac net.HardwareAddr, ip net.IP, op Operation) (*Packet, error) {
+	var target net.HardwareAddr
+	switch op {
+	case OperationRequest:
+		target = ethernet.Broadcast
+	case OperationReply:
+		target = mac
+	default:
+		return nil, ErrInvalidOperation
+	}
+
+	return NewPacket(op, mac, ip, target, ip)
+}
+
+// Match reports whether p has Operation op, and sender and target IPv4
+// addresses equal to senderIP and targetIP, as compared by net.IP.Equal.
+// Hardware addresses are ignored. If senderIP or targetIP is nil, any
+// address matches it.
+//
+// Match is the comparison used by Resolve to identify a reply, and may be
+// used in tests or with ResolveFunc.
+func Match(p *Packet, op Operation, senderIP, targetIP net.IP) bool {
+	if p.Operation != op {
+		return false
+	}
+
+	if senderIP != nil && !p.SenderIP.Equal(senderIP) {
+		return false
+	}
+
+	return targetIP == nil || p.TargetIP.Equal(targetIP)
+}
+
+// Len returns the length of a Packet in its binary form, as determined by
+// its MACLength and IPLength fields.
+func (p *Packet) Len() int {
+	return 2 + 2 + 1 + 1 + 2 + (2 * int(p.MACLength)) + (2 * int(p.IPLength))
+}
+
+// MarshalBinary allocates a byte slice containing the data from a Packet.
+//
+// If the Packet's address lengths are too long, ErrAddressTooLong is
+// returned.
 func (p *Packet) MarshalBinary() ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, p.Len())
+	p.marshal(b)
+
+	return b, nil
+}
+
+// MarshalBinaryTo writes the binary form of a Packet into dst, and returns
+// the number of bytes written. Unlike MarshalBinary, it does not allocate,
+// so dst may be a fixed-size array on the stack.
+//
+// If dst is shorter than Len, io.ErrShortBuffer is returned. If the
+// Packet's address lengths are too long, ErrAddressTooLong is returned.
+func (p *Packet) MarshalBinaryTo(dst []byte) (int, error) {
+	if err := p.Validate(); err != nil {
+		return 0, err
+	}
+
+	n := p.Len()
+	if len(dst) < n {
+		return 0, io.ErrShortBuffer
+	}
+
+	p.marshal(dst[:n])
+	return n, nil
+}
+
+// MarshalBinaryPadded allocates a byte slice containing the data from a
+// Packet in the same way as MarshalBinary, followed by zero bytes so that
+// the slice is at least minLen bytes in length. If minLen is zero or less,
+// the minimum ethernet frame payload length of 46 bytes is used.
+//
+// MarshalBinaryPadded is useful when writing frames to a lower layer which
+// does not pad short frames. UnmarshalBinary ignores any trailing padding.
+func (p *Packet) MarshalBinaryPadded(minLen int) ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	if minLen <= 0 {
+		minLen = minEthernetPayloadLen
+	}
+
+	n := p.Len()
+	l := n
+	if l < minLen {
+		l = minLen
+	}
+
+	b := make([]byte, l)
+	p.marshal(b[:n])
+
+	return b, nil
+}
+
+// Frame marshals a Packet and returns an ARP ethernet frame carrying it,
+// without sending it. The frame's source address is the Packet's sender
+// hardware address, and its destination address is ethDst.
+//
+// If the Packet cannot be marshaled, the error from MarshalBinary is
+// returned.
+func (p *Packet) Frame(ethDst net.HardwareAddr) (*ethernet.Frame, error) {
+	pb, err := p.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ethernet.Frame{
+		Destination: ethDst,
+		Source:      p.SenderMAC,
+		EtherType:   ethernet.EtherTypeARP,
+		Payload:     pb,
+	}, nil
+}
+
+// marshalFrame marshals a Packet into the same untagged ethernet frame as
+// Frame, but with EtherType et, using b as the frame's storage so that no
+// allocation is needed. b must be large enough to contain the frame, and
+// ethDst and the Packet's sender hardware address must each be at least 6
+// bytes in length, so every byte of the header is overwritten.
+func (p *Packet) marshalFrame(b []byte, ethDst net.HardwareAddr, et ethernet.EtherType) ([]byte, error) {
+	// Payloads shorter than the ethernet minimum are zero padded
+	n := 14 + p.Len()
+	if n < 14+minEthernetPayloadLen {
+		n = 14 + minEthernetPayloadLen
+	}
+	b = b[:n]
+
+	copy(b[0:6], ethDst)
+	copy(b[6:12], p.SenderMAC)
+	binary.BigEndian.PutUint16(b[12:14], uint16(et))
+
+	pl, err := p.MarshalBinaryTo(b[14:])
+	if err != nil {
+		return nil, err
+	}
+
+	// The buffer may have been used before, so padding must be cleared
+	pad := b[14+pl:]
+	for i := range pad {
+		pad[i] = 0
+	}
+
+	return b, nil
+}
+
+// marshal writes a Packet into b, which must be exactly Len bytes in
+// length
+func (p *Packet) marshal(b []byte) {
 	// 2 bytes: hardware type
 	// 2 bytes: protocol type
 	// 1 bytes: hardware address length
@@ -134,8 +579,8 @@ func (p *Packet) MarshalBinary() ([]byte, error) {
 
 	// Though an IPv4 address should always be 4 bytes, go-fuzz
 	// very quickly created several crasher scenarios which
-	// indicated that these values can lie
-	b := make([]byte, 2+2+1+1+2+(p.IPLength*2)+(p.MACLength*2))
+	// indicated that these values can lie, so the length fields are
+	// used rather than the lengths of the addresses
 
 	binary.BigEndian.PutUint16(b[0:2], p.HardwareType)
 	binary.BigEndian.PutUint16(b[2:4], p.ProtocolType)
@@ -152,22 +597,58 @@ func (p *Packet) MarshalBinary() ([]byte, error) {
 	copy(b[n:n+hal], p.SenderMAC)
 	n += hal
 
-	copy(b[n:n+pl], p.SenderIP)
+	copy(b[n:n+pl], normalizeIP(p.SenderIP, pl))
 	n += pl
 
 	copy(b[n:n+hal], p.TargetMAC)
 	n += hal
 
-	copy(b[n:n+pl], p.TargetIP)
+	copy(b[n:n+pl], normalizeIP(p.TargetIP, pl))
+}
 
-	return b, nil
+// normalizeIP returns the 4-byte form of ip if l is the length of an IPv4
+// address, so that a 16-byte IPv4 address, such as one created by net.IPv4,
+// is not truncated to its leading zero bytes
+func normalizeIP(ip net.IP, l int) net.IP {
+	if l != net.IPv4len {
+		return ip
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+
+	return ip
 }
 
-// UnmarshalBinary unmarshals a raw byte slice into a Packet
+// UnmarshalBinary unmarshals a raw byte slice into a Packet.
+//
+// If the byte slice is too short, a *DecodeError wrapping io.ErrUnexpectedEOF
+// is returned. If the byte slice indicates address lengths which are too
+// long, a *DecodeError wrapping ErrAddressTooLong is returned.
+//
+// Any bytes following the packet, such as ethernet padding, are ignored.
+//
+// SenderIP and TargetIP are stored as IPLength-byte slices, so for IPv4 they
+// are always 4 bytes in length, matching packets created by NewPacket.
 func (p *Packet) UnmarshalBinary(b []byte) error {
+	_, err := p.UnmarshalBinaryN(b)
+	return err
+}
+
+// UnmarshalBinaryN unmarshals a raw byte slice into a Packet in the same way
+// as UnmarshalBinary, and returns the number of bytes consumed, which is
+// the Packet's Len. This allows decoding multiple packets from a single
+// byte slice, such as a log of concatenated packets.
+func (p *Packet) UnmarshalBinaryN(b []byte) (int, error) {
 	// Must have enough room to retrieve MAC and IP lengths
 	if len(b) < 8 {
-		return io.ErrUnexpectedEOF
+		return 0, newDecodeError(b, 0, io.ErrUnexpectedEOF)
+	}
+
+	// Reject unreasonable address lengths before allocating
+	if err := validateLengths(b[4], b[5]); err != nil {
+		return 0, newDecodeError(b, 4, err)
 	}
 
 	p.HardwareType = binary.BigEndian.Uint16(b[0:2])
@@ -184,9 +665,11 @@ func (p *Packet) UnmarshalBinary(b []byte) error {
 	il := int(p.IPLength)
 	il2 := il * 2
 
+	// addrl can be no greater than MaxPacketLen, which bounds the
+	// allocation below, even if MaxMACLength or MaxIPLength are raised
 	addrl := n + ml2 + il2
 	if len(b) < addrl {
-		return io.ErrUnexpectedEOF
+		return 0, newDecodeError(b, n, io.ErrUnexpectedEOF)
 	}
 
 	bb := make([]byte, addrl-n)
@@ -206,22 +689,200 @@ func (p *Packet) UnmarshalBinary(b []byte) error {
 	copy(bb[ml2+il:ml2+il2], b[n:n+il])
 	p.TargetIP = bb[ml2+il : ml2+il2]
 
-	return nil
+	return addrl, nil
+}
+
+// Text encodes a Packet as key=value lines, one per field, in a fixed
+// order:
+//
+//	operation=OperationRequest
+//	hardware-type=1
+//	protocol-type=0x0800
+//	sender-mac=de:ad:be:ef:de:ad
+//	sender-ip=192.168.1.1
+//	target-mac=00:00:00:00:00:00
+//	target-ip=192.168.1.10
+//
+// The format is intended for storing packets as readable, diffable test
+// fixtures. Operations which are not known are encoded in decimal form.
+// MACLength and IPLength are not encoded, as they are implied by the
+// addresses. Use ParsePacketText to decode the result.
+//
+// Text deliberately does not implement encoding.TextMarshaler, so that
+// encoders such as encoding/json continue to encode a Packet's fields.
+func (p *Packet) Text() ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	op, err := p.Operation.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "operation=%s\n", op)
+	fmt.Fprintf(&b, "hardware-type=%d\n", p.HardwareType)
+	fmt.Fprintf(&b, "protocol-type=%#04x\n", p.ProtocolType)
+	fmt.Fprintf(&b, "sender-mac=%s\n", p.SenderMAC)
+	fmt.Fprintf(&b, "sender-ip=%s\n", p.SenderIP)
+	fmt.Fprintf(&b, "target-mac=%s\n", p.TargetMAC)
+	fmt.Fprintf(&b, "target-ip=%s\n", p.TargetIP)
+
+	return b.Bytes(), nil
 }
 
+// ParsePacketText decodes a Packet from the key=value format produced by
+// Packet.Text. Keys may appear in any order, and blank lines and lines
+// beginning with '#' are ignored. hardware-type and protocol-type are
+// optional, and default to ethernet and IPv4; all other keys are required.
+//
+// If the input cannot be parsed, an error wrapping ErrInvalidPacketText is
+// returned.
+func ParsePacketText(b []byte) (*Packet, error) {
+	p := &Packet{
+		HardwareType: uint16(HardwareTypeEthernet),
+		ProtocolType: uint16(ethernet.EtherTypeIPv4),
+	}
+
+	seen := make(map[string]bool)
+	for i, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("line %d: missing '=': %w", i+1, ErrInvalidPacketText)
+		}
+
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		if seen[key] {
+			return nil, fmt.Errorf("line %d: duplicate key %q: %w", i+1, key, ErrInvalidPacketText)
+		}
+		seen[key] = true
+
+		var err error
+		switch key {
+		case "operation":
+			err = p.Operation.UnmarshalText([]byte(value))
+		case "hardware-type":
+			p.HardwareType, err = parseUint16(value)
+		case "protocol-type":
+			p.ProtocolType, err = parseUint16(value)
+		case "sender-mac":
+			p.SenderMAC, err = net.ParseMAC(value)
+		case "sender-ip":
+			p.SenderIP, err = parseTextIP(value)
+		case "target-mac":
+			p.TargetMAC, err = net.ParseMAC(value)
+		case "target-ip":
+			p.TargetIP, err = parseTextIP(value)
+		default:
+			return nil, fmt.Errorf("line %d: unknown key %q: %w", i+1, key, ErrInvalidPacketText)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid %s %q: %w", i+1, key, value, ErrInvalidPacketText)
+		}
+	}
+
+	for _, key := range []string{"operation", "sender-mac", "sender-ip", "target-mac", "target-ip"} {
+		if !seen[key] {
+			return nil, fmt.Errorf("missing key %q: %w", key, ErrInvalidPacketText)
+		}
+	}
+
+	if len(p.SenderMAC) != len(p.TargetMAC) {
+		return nil, fmt.Errorf("hardware address length mismatch: %w", ErrInvalidPacketText)
+	}
+	if len(p.SenderIP) != len(p.TargetIP) {
+		return nil, fmt.Errorf("protocol address length mismatch: %w", ErrInvalidPacketText)
+	}
+
+	p.MACLength = uint8(len(p.SenderMAC))
+	p.IPLength = uint8(len(p.SenderIP))
+
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// parseUint16 parses a decimal or 0x-prefixed hexadecimal 16-bit value
+func parseUint16(s string) (uint16, error) {
+	n, err := strconv.ParseUint(s, 0, 16)
+	return uint16(n), err
+}
+
+// parseTextIP parses an IP address, storing IPv4 addresses in 4 bytes as
+// NewPacket does
+func parseTextIP(s string) (net.IP, error) {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, ErrInvalidIP
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4, nil
+	}
+
+	return ip, nil
+}
+
+// ParsePacket parses the raw bytes of an ethernet frame, such as one
+// captured using another library or read from a pcap file, and the ARP
+// packet in its payload. This allows the package to be used as an ARP
+// decoder without opening a socket.
+//
+// If the frame is valid but does not contain an ARP packet, the frame is
+// returned together with a *NotARPError. If the frame or packet cannot be
+// decoded, a *DecodeError is returned, which wraps io.ErrUnexpectedEOF or
+// another error describing the problem.
+func ParsePacket(frame []byte) (*Packet, *ethernet.Frame, error) {
+	p, f, err := parsePacket(frame)
+	if err == errInvalidARPPacket {
+		return nil, f, &NotARPError{Frame: f}
+	}
+
+	return p, f, err
+}
+
+// parsePacket parses an ethernet frame and the ARP packet in its payload.
+// If the frame is valid but does not contain an ARP packet, the frame is
+// returned together with errInvalidARPPacket.
 func parsePacket(buf []byte) (*Packet, *ethernet.Frame, error) {
+	return parsePacketType(buf, ethernet.EtherTypeARP)
+}
+
+// parsePacketType parses an ethernet frame in the same way as parsePacket,
+// but expects the frame's EtherType to be et, such as for RARP.
+func parsePacketType(buf []byte, et ethernet.EtherType) (*Packet, *ethernet.Frame, error) {
 	f := new(ethernet.Frame)
 	if err := f.UnmarshalBinary(buf); err != nil {
-		return nil, nil, err
+		return nil, nil, newDecodeError(buf, 0, err)
 	}
 
-	// Ignore frames do not have ARP EtherType
-	if f.EtherType != ethernet.EtherTypeARP {
-		return nil, nil, errInvalidARPPacket
+	// Ignore frames do not have the expected EtherType. If the frame
+	// carries one or more 802.1Q VLAN tags, EtherType is the inner
+	// EtherType, and the tags are available in the frame's VLAN field
+	if f.EtherType != et {
+		return nil, f, errInvalidARPPacket
+	}
+
+	// Report frames which claim to carry ARP, but which are too short to
+	// do so, separately from other decoding errors
+	if len(f.Payload) < 8 {
+		return nil, nil, newDecodeError(buf, len(buf)-len(f.Payload), ErrTruncatedARP)
 	}
 
 	p := new(Packet)
 	if err := p.UnmarshalBinary(f.Payload); err != nil {
+		// Report offsets relative to the start of the frame
+		if derr, ok := err.(*DecodeError); ok {
+			err = newDecodeError(buf, len(buf)-len(f.Payload)+derr.Offset, derr.Err)
+		}
+
 		return nil, nil, err
 	}
 
@@ -2,6 +2,8 @@ package arp
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"io"
 	"net"
 	"reflect"
@@ -144,6 +146,422 @@ func TestNewPacket(t *testing.T) {
 	}
 }
 
+func TestNewReplyFor(t *testing.T) {
+	reqMAC := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	reqIP := net.IP{192, 168, 1, 10}
+	mac := net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+	ip := net.IP{192, 168, 1, 1}
+
+	req, err := NewPacket(OperationRequest, reqMAC, reqIP, ethernet.Broadcast, ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NewReplyFor(req, mac, ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Packet{
+		HardwareType: 1,
+		ProtocolType: uint16(ethernet.EtherTypeIPv4),
+		MACLength:    6,
+		IPLength:     4,
+		Operation:    OperationReply,
+		SenderMAC:    mac,
+		SenderIP:     ip,
+		TargetMAC:    reqMAC,
+		TargetIP:     reqIP,
+	}
+
+	if got := p; !reflect.DeepEqual(want, got) {
+		t.Fatalf("unexpected reply Packet:\n- want: %v\n- got: %v", want, got)
+	}
+
+	if _, err := NewReplyFor(req, mac, net.IPv6loopback); err != ErrInvalidIP {
+		t.Fatalf("unexpected error for IPv6 sender address: %v", err)
+	}
+}
+
+func TestNewReplyForInfiniBand(t *testing.T) {
+	reqMAC := net.HardwareAddr(bytes.Repeat([]byte{0xaa}, 20))
+	mac := net.HardwareAddr(bytes.Repeat([]byte{0xde}, 20))
+	ip := net.IP{192, 168, 1, 1}
+
+	req, err := NewPacketBuilder().
+		Operation(OperationRequest).
+		Sender(reqMAC, net.IP{192, 168, 1, 10}).
+		Target(make(net.HardwareAddr, 20), ip).
+		HardwareType(32).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Round-trip the request to mimic one received from the network
+	b, err := req.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = new(Packet)
+	if err := req.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NewReplyFor(req, mac, ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := uint16(32), p.HardwareType; want != got {
+		t.Fatalf("unexpected hardware type: %v != %v", want, got)
+	}
+	if want, got := req.ProtocolType, p.ProtocolType; want != got {
+		t.Fatalf("unexpected protocol type: %v != %v", want, got)
+	}
+	if want, got := req.MACLength, p.MACLength; want != got {
+		t.Fatalf("unexpected MAC length: %v != %v", want, got)
+	}
+	if want, got := req.IPLength, p.IPLength; want != got {
+		t.Fatalf("unexpected IP length: %v != %v", want, got)
+	}
+}
+
+func TestNewProbePacket(t *testing.T) {
+	mac := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	target := net.IPv4(192, 168, 1, 10)
+
+	p, err := NewProbePacket(mac, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Packet{
+		HardwareType: 1,
+		ProtocolType: uint16(ethernet.EtherTypeIPv4),
+		MACLength:    6,
+		IPLength:     4,
+		Operation:    OperationRequest,
+		SenderMAC:    mac,
+		SenderIP:     net.IPv4zero.To4(),
+		TargetMAC:    net.HardwareAddr{0, 0, 0, 0, 0, 0},
+		TargetIP:     target.To4(),
+	}
+
+	if got := p; !reflect.DeepEqual(want, got) {
+		t.Fatalf("unexpected probe Packet:\n- want: %v\n- got: %v", want, got)
+	}
+
+	if _, err := NewProbePacket(net.HardwareAddr{0, 0, 0}, target); err != ErrInvalidMAC {
+		t.Fatalf("unexpected error for short MAC address: %v", err)
+	}
+	if _, err := NewProbePacket(mac, net.IPv6loopback); err != ErrInvalidIP {
+		t.Fatalf("unexpected error for IPv6 address: %v", err)
+	}
+}
+
+func TestNewAnnouncementPacket(t *testing.T) {
+	mac := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	ip := net.IPv4(192, 168, 1, 10)
+
+	p, err := NewAnnouncementPacket(mac, ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := KindAnnouncement, Classify(p); want != got {
+		t.Fatalf("unexpected packet kind: %v != %v", want, got)
+	}
+	if want, got := mac, p.SenderMAC; !bytes.Equal(want, got) {
+		t.Fatalf("unexpected sender MAC: %v != %v", want, got)
+	}
+	if want, got := ip, p.SenderIP; !want.Equal(got) {
+		t.Fatalf("unexpected sender IP: %v != %v", want, got)
+	}
+
+	if _, err := NewAnnouncementPacket(mac, net.IPv6loopback); err != ErrInvalidIP {
+		t.Fatalf("unexpected error for IPv6 address: %v", err)
+	}
+}
+
+func TestNewGratuitousPacket(t *testing.T) {
+	mac := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	ip := net.IPv4(192, 168, 1, 10)
+
+	var tests = []struct {
+		desc string
+		op   Operation
+		p    *Packet
+		kind PacketKind
+		err  error
+	}{
+		{
+			desc: "request",
+			op:   OperationRequest,
+			p: &Packet{
+				HardwareType: 1,
+				ProtocolType: uint16(ethernet.EtherTypeIPv4),
+				MACLength:    6,
+				IPLength:     4,
+				Operation:    OperationRequest,
+				SenderMAC:    mac,
+				SenderIP:     ip.To4(),
+				TargetMAC:    ethernet.Broadcast,
+				TargetIP:     ip.To4(),
+			},
+			kind: KindGratuitousRequest,
+		},
+		{
+			desc: "reply",
+			op:   OperationReply,
+			p: &Packet{
+				HardwareType: 1,
+				ProtocolType: uint16(ethernet.EtherTypeIPv4),
+				MACLength:    6,
+				IPLength:     4,
+				Operation:    OperationReply,
+				SenderMAC:    mac,
+				SenderIP:     ip.To4(),
+				TargetMAC:    mac,
+				TargetIP:     ip.To4(),
+			},
+			kind: KindGratuitousReply,
+		},
+		{
+			desc: "invalid operation",
+			op:   Operation(3),
+			err:  ErrInvalidOperation,
+		},
+	}
+
+	for i, tt := range tests {
+		p, err := NewGratuitousPacket(mac, ip, tt.op)
+		if err != nil {
+			if want, got := tt.err, err; want != got {
+				t.Fatalf("[%02d] test %q, unexpected error: %v != %v",
+					i, tt.desc, want, got)
+			}
+
+			continue
+		}
+
+		if want, got := tt.p, p; !reflect.DeepEqual(want, got) {
+			t.Fatalf("[%02d] test %q, unexpected Packet:\n- want: %v\n- got: %v",
+				i, tt.desc, want, got)
+		}
+		if want, got := tt.kind, Classify(p); want != got {
+			t.Fatalf("[%02d] test %q, unexpected packet kind: %v != %v",
+				i, tt.desc, want, got)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	senderIP := net.IPv4(192, 168, 1, 10)
+	targetIP := net.IPv4(192, 168, 1, 1)
+
+	p, err := NewPacket(
+		OperationReply,
+		net.HardwareAddr{0xad, 0xbe, 0xef, 0xde, 0xad, 0xde},
+		senderIP,
+		net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+		targetIP,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		desc     string
+		op       Operation
+		senderIP net.IP
+		targetIP net.IP
+		ok       bool
+	}{
+		{
+			desc:     "exact match",
+			op:       OperationReply,
+			senderIP: senderIP,
+			targetIP: targetIP,
+			ok:       true,
+		},
+		{
+			desc:     "4-byte addresses",
+			op:       OperationReply,
+			senderIP: net.IP{192, 168, 1, 10},
+			targetIP: net.IP{192, 168, 1, 1},
+			ok:       true,
+		},
+		{
+			desc:     "any target",
+			op:       OperationReply,
+			senderIP: senderIP,
+			ok:       true,
+		},
+		{
+			desc: "any addresses",
+			op:   OperationReply,
+			ok:   true,
+		},
+		{
+			desc:     "wrong operation",
+			op:       OperationRequest,
+			senderIP: senderIP,
+			targetIP: targetIP,
+		},
+		{
+			desc:     "wrong sender",
+			op:       OperationReply,
+			senderIP: net.IPv4(192, 168, 1, 11),
+			targetIP: targetIP,
+		},
+		{
+			desc:     "wrong target",
+			op:       OperationReply,
+			senderIP: senderIP,
+			targetIP: net.IPv4(192, 168, 1, 2),
+		},
+		{
+			desc:     "swapped addresses",
+			op:       OperationReply,
+			senderIP: targetIP,
+			targetIP: senderIP,
+		},
+	}
+
+	for i, tt := range tests {
+		if want, got := tt.ok, Match(p, tt.op, tt.senderIP, tt.targetIP); want != got {
+			t.Fatalf("[%02d] test %q, unexpected match result: %v != %v",
+				i, tt.desc, want, got)
+		}
+	}
+}
+
+func TestOperationMarshalText(t *testing.T) {
+	for _, op := range []Operation{OperationRequest, OperationReply, 0, 3, 4, 65535} {
+		b, err := op.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got Operation
+		if err := got.UnmarshalText(b); err != nil {
+			t.Fatal(err)
+		}
+
+		if want := op; want != got {
+			t.Fatalf("unexpected Operation after round trip of %q: %v != %v",
+				string(b), want, got)
+		}
+	}
+
+	b, err := Operation(3).MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "3", string(b); want != got {
+		t.Fatalf("unexpected text for unnamed Operation: %q != %q", want, got)
+	}
+
+}
+
+func TestOperationJSON(t *testing.T) {
+	var tests = []struct {
+		desc string
+		op   Operation
+		b    string
+	}{
+		{
+			desc: "request",
+			op:   OperationRequest,
+			b:    `{"Op":1}`,
+		},
+		{
+			desc: "reply",
+			op:   OperationReply,
+			b:    `{"Op":2}`,
+		},
+		{
+			desc: "unnamed",
+			op:   4,
+			b:    `{"Op":4}`,
+		},
+	}
+
+	type opStruct struct{ Op Operation }
+
+	for i, tt := range tests {
+		// Operations are encoded as numbers, as they were before Operation
+		// implemented encoding.TextMarshaler
+		b, err := json.Marshal(opStruct{Op: tt.op})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want, got := tt.b, string(b); want != got {
+			t.Fatalf("[%02d] test %q, unexpected JSON: %s != %s",
+				i, tt.desc, want, got)
+		}
+
+		var v opStruct
+		if err := json.Unmarshal(b, &v); err != nil {
+			t.Fatal(err)
+		}
+
+		if want, got := tt.op, v.Op; want != got {
+			t.Fatalf("[%02d] test %q, unexpected Operation: %v != %v",
+				i, tt.desc, want, got)
+		}
+	}
+
+	var v opStruct
+	if err := json.Unmarshal([]byte(`{"Op":"reply"}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := OperationReply, v.Op; want != got {
+		t.Fatalf("unexpected Operation from JSON string: %v != %v", want, got)
+	}
+
+	if err := json.Unmarshal([]byte(`{"Op":65536}`), &v); err != ErrInvalidOperation {
+		t.Fatalf("unexpected error for out of range Operation: %v", err)
+	}
+}
+
+func TestOperationUnmarshalText(t *testing.T) {
+	var tests = []struct {
+		s   string
+		op  Operation
+		err error
+	}{
+		{s: "request", op: OperationRequest},
+		{s: "REPLY", op: OperationReply},
+		{s: "OperationRequest", op: OperationRequest},
+		{s: "operationreply", op: OperationReply},
+		{s: "3", op: 3},
+		{s: "", err: ErrInvalidOperation},
+		{s: "probe", err: ErrInvalidOperation},
+		{s: "-1", err: ErrInvalidOperation},
+		{s: "65536", err: ErrInvalidOperation},
+	}
+
+	for i, tt := range tests {
+		var op Operation
+		if err := op.UnmarshalText([]byte(tt.s)); err != nil {
+			if want, got := tt.err, err; want != got {
+				t.Fatalf("[%02d] input %q, unexpected error: %v != %v",
+					i, tt.s, want, got)
+			}
+
+			continue
+		}
+
+		if want, got := tt.op, op; want != got {
+			t.Fatalf("[%02d] input %q, unexpected Operation: %v != %v",
+				i, tt.s, want, got)
+		}
+	}
+}
+
 func TestPacketMarshalBinary(t *testing.T) {
 	zeroMAC := net.HardwareAddr{0, 0, 0, 0, 0, 0}
 	ip1 := net.IP{192, 168, 1, 10}
@@ -183,44 +601,736 @@ func TestPacketMarshalBinary(t *testing.T) {
 			},
 		},
 		{
-			desc: "ARP reply over infiniband, 20 byte MAC addresses",
-			p: &Packet{
-				HardwareType: 32,
-				ProtocolType: uint16(ethernet.EtherTypeIPv4),
-				MACLength:    20,
-				IPLength:     4,
-				Operation:    OperationReply,
-				SenderMAC:    iboip1,
-				SenderIP:     ip1,
-				TargetMAC:    iboip2,
-				TargetIP:     ip2,
-			},
-			b: []byte{
-				0, 32,
-				8, 0,
-				20,
-				4,
-				0, 2,
-				0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
-				0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
-				192, 168, 1, 10,
-				1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
-				1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
-				192, 168, 1, 1,
-			},
+			desc: "ARP reply over infiniband, 20 byte MAC addresses",
+			p: &Packet{
+				HardwareType: 32,
+				ProtocolType: uint16(ethernet.EtherTypeIPv4),
+				MACLength:    20,
+				IPLength:     4,
+				Operation:    OperationReply,
+				SenderMAC:    iboip1,
+				SenderIP:     ip1,
+				TargetMAC:    iboip2,
+				TargetIP:     ip2,
+			},
+			b: []byte{
+				0, 32,
+				8, 0,
+				20,
+				4,
+				0, 2,
+				0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+				192, 168, 1, 10,
+				1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+				1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+				192, 168, 1, 1,
+			},
+		},
+	}
+
+	for i, tt := range tests {
+		b, err := tt.p.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want, got := tt.b, b; !bytes.Equal(want, got) {
+			t.Fatalf("[%02d] test %q, unexpected Packet bytes:\n- want: %v\n- got: %v",
+				i, tt.desc, want, got)
+		}
+	}
+}
+
+func TestPacketMarshalBinaryTo(t *testing.T) {
+	p, err := NewPacket(
+		OperationRequest,
+		net.HardwareAddr{0xad, 0xbe, 0xef, 0xde, 0xad, 0xde},
+		net.IP{192, 168, 1, 10},
+		net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+		net.IP{192, 168, 1, 1},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf [64]byte
+	n, err := p.MarshalBinaryTo(buf[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := buf[:n]; !bytes.Equal(want, got) {
+		t.Fatalf("unexpected Packet bytes:\n- want: %v\n-  got: %v", want, got)
+	}
+
+	if _, err := p.MarshalBinaryTo(buf[:p.Len()-1]); err != io.ErrShortBuffer {
+		t.Fatalf("unexpected error for short buffer: %v", err)
+	}
+}
+
+func TestPacketMarshalBinaryToNoAllocs(t *testing.T) {
+	p, err := NewPacket(
+		OperationRequest,
+		net.HardwareAddr{0xad, 0xbe, 0xef, 0xde, 0xad, 0xde},
+		net.IP{192, 168, 1, 10},
+		net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+		net.IP{192, 168, 1, 1},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf [64]byte
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, err := p.MarshalBinaryTo(buf[:]); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if want, got := 0.0, allocs; want != got {
+		t.Fatalf("unexpected number of allocations by MarshalBinaryTo: %v != %v", want, got)
+	}
+
+	// The ethernet frame written by Client.WriteTo is built in the same
+	// way, without allocating
+	allocs = testing.AllocsPerRun(100, func() {
+		if _, err := p.marshalFrame(buf[:], ethernet.Broadcast, ethernet.EtherTypeARP); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if want, got := 0.0, allocs; want != got {
+		t.Fatalf("unexpected number of allocations by marshalFrame: %v != %v", want, got)
+	}
+}
+
+func TestPacketMarshalBinaryPadded(t *testing.T) {
+	p, err := NewPacket(
+		OperationRequest,
+		net.HardwareAddr{0xad, 0xbe, 0xef, 0xde, 0xad, 0xde},
+		net.IP{192, 168, 1, 10},
+		net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+		net.IP{192, 168, 1, 1},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		desc   string
+		minLen int
+		l      int
+	}{
+		{desc: "default minimum", l: 46},
+		{desc: "negative minimum", minLen: -1, l: 46},
+		{desc: "larger minimum", minLen: 60, l: 60},
+		{desc: "minimum shorter than packet", minLen: 10, l: p.Len()},
+	}
+
+	for i, tt := range tests {
+		b, err := p.MarshalBinaryPadded(tt.minLen)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want, got := tt.l, len(b); want != got {
+			t.Fatalf("[%02d] test %q, unexpected length: %v != %v",
+				i, tt.desc, want, got)
+		}
+		if got := b[:len(want)]; !bytes.Equal(want, got) {
+			t.Fatalf("[%02d] test %q, unexpected Packet bytes:\n- want: %v\n-  got: %v",
+				i, tt.desc, want, got)
+		}
+		if pad := b[len(want):]; !bytes.Equal(make([]byte, len(pad)), pad) {
+			t.Fatalf("[%02d] test %q, padding is not zeroed: %v",
+				i, tt.desc, pad)
+		}
+
+		got := new(Packet)
+		if err := got.UnmarshalBinary(b); err != nil {
+			t.Fatalf("[%02d] test %q, unexpected error: %v",
+				i, tt.desc, err)
+		}
+		if !reflect.DeepEqual(p, got) {
+			t.Fatalf("[%02d] test %q, padded packet did not round-trip:\n- want: %v\n-  got: %v",
+				i, tt.desc, p, got)
+		}
+	}
+}
+
+func TestPacketFrame(t *testing.T) {
+	srcMAC := net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+	dstMAC := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+
+	p, err := NewPacket(OperationReply, srcMAC, net.IP{192, 168, 1, 1}, dstMAC, net.IP{192, 168, 1, 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := p.Frame(dstMAC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := dstMAC, f.Destination; !bytes.Equal(want, got) {
+		t.Fatalf("unexpected destination: %v != %v", want, got)
+	}
+	if want, got := srcMAC, f.Source; !bytes.Equal(want, got) {
+		t.Fatalf("unexpected source: %v != %v", want, got)
+	}
+	if want, got := ethernet.EtherTypeARP, f.EtherType; want != got {
+		t.Fatalf("unexpected EtherType: %v != %v", want, got)
+	}
+
+	pb, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := pb, f.Payload; !bytes.Equal(want, got) {
+		t.Fatalf("unexpected payload:\n- want: %v\n-  got: %v", want, got)
+	}
+
+	p.MACLength = 255
+	if _, err := p.Frame(dstMAC); err != ErrAddressTooLong {
+		t.Fatalf("unexpected error for invalid Packet: %v", err)
+	}
+}
+
+func TestPacketValidate(t *testing.T) {
+	var tests = []struct {
+		desc string
+		ml   uint8
+		il   uint8
+		err  error
+	}{
+		{
+			desc: "ethernet and IPv4",
+			ml:   6,
+			il:   4,
+		},
+		{
+			desc: "maximum lengths",
+			ml:   20,
+			il:   16,
+		},
+		{
+			desc: "MAC address length too long",
+			ml:   21,
+			il:   4,
+			err:  ErrAddressTooLong,
+		},
+		{
+			desc: "IP address length too long",
+			ml:   6,
+			il:   17,
+			err:  ErrAddressTooLong,
+		},
+	}
+
+	for i, tt := range tests {
+		p := &Packet{
+			MACLength: tt.ml,
+			IPLength:  tt.il,
+		}
+
+		if want, got := tt.err, p.Validate(); want != got {
+			t.Fatalf("[%02d] test %q, unexpected error: %v != %v",
+				i, tt.desc, want, got)
+		}
+
+		if _, err := p.MarshalBinary(); tt.err != err {
+			t.Fatalf("[%02d] test %q, unexpected MarshalBinary error: %v != %v",
+				i, tt.desc, tt.err, err)
+		}
+	}
+}
+
+func TestPacketValidateStrict(t *testing.T) {
+	var tests = []struct {
+		desc string
+		p    *Packet
+		err  error
+	}{
+		{
+			desc: "unicast sender",
+			p: &Packet{
+				MACLength: 6,
+				IPLength:  4,
+				SenderMAC: net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff},
+			},
+		},
+		{
+			desc: "broadcast sender",
+			p: &Packet{
+				MACLength: 6,
+				IPLength:  4,
+				SenderMAC: ethernet.Broadcast,
+			},
+			err: ErrInvalidSenderMAC,
+		},
+		{
+			desc: "multicast sender",
+			p: &Packet{
+				MACLength: 6,
+				IPLength:  4,
+				SenderMAC: net.HardwareAddr{0x01, 0x00, 0x5e, 0x00, 0x00, 0x01},
+			},
+			err: ErrInvalidSenderMAC,
+		},
+		{
+			desc: "address length too long",
+			p: &Packet{
+				MACLength: 21,
+				IPLength:  4,
+				SenderMAC: ethernet.Broadcast,
+			},
+			err: ErrAddressTooLong,
+		},
+	}
+
+	for i, tt := range tests {
+		if want, got := tt.err, tt.p.ValidateStrict(); want != got {
+			t.Fatalf("[%02d] test %q, unexpected error: %v != %v",
+				i, tt.desc, want, got)
+		}
+	}
+}
+
+func TestPacketValidateOverride(t *testing.T) {
+	defer func(ml int) { MaxMACLength = ml }(MaxMACLength)
+	MaxMACLength = 32
+
+	p := &Packet{
+		MACLength: 32,
+		IPLength:  4,
+	}
+
+	if err := p.Validate(); err != nil {
+		t.Fatalf("unexpected error with raised maximum: %v", err)
+	}
+}
+
+func TestPacketLen(t *testing.T) {
+	var tests = []struct {
+		desc string
+		ml   int
+		il   int
+	}{
+		{desc: "ethernet and IPv4", ml: 6, il: 4},
+		{desc: "EUI-64 and IPv4", ml: 8, il: 4},
+		{desc: "InfiniBand and IPv4", ml: 20, il: 4},
+		{desc: "ethernet and 16 byte protocol addresses", ml: 6, il: 16},
+	}
+
+	for i, tt := range tests {
+		p := &Packet{
+			MACLength: uint8(tt.ml),
+			IPLength:  uint8(tt.il),
+			SenderMAC: make(net.HardwareAddr, tt.ml),
+			SenderIP:  make(net.IP, tt.il),
+			TargetMAC: make(net.HardwareAddr, tt.ml),
+			TargetIP:  make(net.IP, tt.il),
+		}
+
+		b, err := p.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want, got := len(b), p.Len(); want != got {
+			t.Fatalf("[%02d] test %q, unexpected length: %v != %v",
+				i, tt.desc, want, got)
+		}
+	}
+}
+
+func TestPacketMarshalUnmarshalBinaryRoundTrip(t *testing.T) {
+	var tests = []struct {
+		desc string
+		ml   int
+	}{
+		{desc: "ethernet", ml: 6},
+		{desc: "EUI-64", ml: 8},
+		{desc: "InfiniBand", ml: 20},
+	}
+
+	// seq returns n bytes counting up from start, so misplaced fields are
+	// detected
+	seq := func(start byte, n int) []byte {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = start + byte(i)
+		}
+		return b
+	}
+
+	for i, tt := range tests {
+		for _, op := range []Operation{OperationRequest, OperationReply} {
+			want, err := NewPacket(
+				op,
+				net.HardwareAddr(seq(0x10, tt.ml)),
+				net.IPv4(192, 168, 1, 10),
+				net.HardwareAddr(seq(0x80, tt.ml)),
+				net.IPv4(192, 168, 1, 1),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			b, err := want.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := new(Packet)
+			if err := got.UnmarshalBinary(b); err != nil {
+				t.Fatalf("[%02d] test %q, unexpected error: %v",
+					i, tt.desc, err)
+			}
+
+			if !reflect.DeepEqual(want, got) {
+				t.Fatalf("[%02d] test %q, %v packet did not round-trip:\n- want: %v\n-  got: %v",
+					i, tt.desc, op, want, got)
+			}
+		}
+	}
+}
+
+func TestPacketTextRoundTrip(t *testing.T) {
+	ethernetPacket, err := NewPacket(
+		OperationRequest,
+		net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+		net.IPv4(192, 168, 1, 1),
+		ethernet.Broadcast,
+		net.IPv4(192, 168, 1, 10),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	infiniBandPacket, err := NewPacketBuilder().
+		Operation(OperationReply).
+		Sender(net.HardwareAddr(bytes.Repeat([]byte{0xaa}, 20)), net.IP{192, 168, 1, 10}).
+		Target(net.HardwareAddr(bytes.Repeat([]byte{0xde}, 20)), net.IP{192, 168, 1, 1}).
+		HardwareType(32).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		desc string
+		p    *Packet
+		text string
+	}{
+		{
+			desc: "ethernet",
+			p:    ethernetPacket,
+			text: "operation=OperationRequest\n" +
+				"hardware-type=1\n" +
+				"protocol-type=0x0800\n" +
+				"sender-mac=de:ad:be:ef:de:ad\n" +
+				"sender-ip=192.168.1.1\n" +
+				"target-mac=ff:ff:ff:ff:ff:ff\n" +
+				"target-ip=192.168.1.10\n",
+		},
+		{
+			desc: "InfiniBand",
+			p:    infiniBandPacket,
+		},
+	}
+
+	for i, tt := range tests {
+		b, err := tt.p.Text()
+		if err != nil {
+			t.Fatalf("[%02d] test %q, unexpected error: %v",
+				i, tt.desc, err)
+		}
+
+		if tt.text != "" {
+			if want, got := tt.text, string(b); want != got {
+				t.Fatalf("[%02d] test %q, unexpected text:\n- want: %q\n-  got: %q",
+					i, tt.desc, want, got)
+			}
+		}
+
+		got, err := ParsePacketText(b)
+		if err != nil {
+			t.Fatalf("[%02d] test %q, unexpected error: %v",
+				i, tt.desc, err)
+		}
+
+		if !reflect.DeepEqual(tt.p, got) {
+			t.Fatalf("[%02d] test %q, packet did not round-trip:\n- want: %v\n-  got: %v",
+				i, tt.desc, tt.p, got)
+		}
+	}
+}
+
+func TestPacketJSONUnaffectedByText(t *testing.T) {
+	p, err := NewPacket(
+		OperationReply,
+		net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+		net.IPv4(192, 168, 1, 1),
+		net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff},
+		net.IPv4(192, 168, 1, 10),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Packets must still encode as the same JSON objects as before Text
+	// and Operation.MarshalText were added, not as their text form
+	b, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"HardwareType":1,"ProtocolType":2048,"MACLength":6,"IPLength":4,` +
+		`"Operation":2,"SenderMAC":"3q2+796t","SenderIP":"192.168.1.1",` +
+		`"TargetMAC":"qrvM3e7/","TargetIP":"192.168.1.10"}`
+	if got := string(b); want != got {
+		t.Fatalf("unexpected JSON:\n- want: %s\n-  got: %s", want, got)
+	}
+
+	got := new(Packet)
+	if err := json.Unmarshal(b, got); err != nil {
+		t.Fatalf("failed to decode %s: %v", b, err)
+	}
+
+	if want, got := p.Operation, got.Operation; want != got {
+		t.Fatalf("unexpected operation: %v != %v", want, got)
+	}
+	if want, got := p.SenderMAC, got.SenderMAC; !bytes.Equal(want, got) {
+		t.Fatalf("unexpected sender MAC: %v != %v", want, got)
+	}
+	if want, got := p.TargetIP, got.TargetIP; !want.Equal(got) {
+		t.Fatalf("unexpected target IP: %v != %v", want, got)
+	}
+}
+
+func TestParsePacketText(t *testing.T) {
+	const valid = "sender-mac=de:ad:be:ef:de:ad\n" +
+		"sender-ip=192.168.1.1\n" +
+		"target-mac=00:00:00:00:00:00\n" +
+		"target-ip=192.168.1.10\n"
+
+	var tests = []struct {
+		desc string
+		text string
+		op   Operation
+		ok   bool
+	}{
+		{
+			desc: "short operation name, comments, and defaults",
+			text: "# probe for 192.168.1.10\n\noperation=request\n" + valid,
+			op:   OperationRequest,
+			ok:   true,
+		},
+		{
+			desc: "numeric operation",
+			text: "operation=3\n" + valid,
+			op:   3,
+			ok:   true,
+		},
+		{
+			desc: "missing operation",
+			text: valid,
+		},
+		{
+			desc: "unknown key",
+			text: "operation=reply\nfoo=bar\n" + valid,
+		},
+		{
+			desc: "duplicate key",
+			text: "operation=reply\noperation=reply\n" + valid,
+		},
+		{
+			desc: "no separator",
+			text: "operation reply\n" + valid,
+		},
+		{
+			desc: "bad MAC",
+			text: "operation=reply\nsender-mac=foo\n" +
+				"sender-ip=192.168.1.1\n" +
+				"target-mac=00:00:00:00:00:00\n" +
+				"target-ip=192.168.1.10\n",
+		},
+		{
+			desc: "MAC length mismatch",
+			text: "operation=reply\nsender-mac=de:ad:be:ef:de:ad:be:ef\n" +
+				"sender-ip=192.168.1.1\n" +
+				"target-mac=00:00:00:00:00:00\n" +
+				"target-ip=192.168.1.10\n",
 		},
 	}
 
 	for i, tt := range tests {
-		b, err := tt.p.MarshalBinary()
+		p, err := ParsePacketText([]byte(tt.text))
+		if tt.ok {
+			if err != nil {
+				t.Fatalf("[%02d] test %q, unexpected error: %v",
+					i, tt.desc, err)
+			}
+		} else {
+			if !errors.Is(err, ErrInvalidPacketText) {
+				t.Fatalf("[%02d] test %q, unexpected error: %v != %v",
+					i, tt.desc, ErrInvalidPacketText, err)
+			}
+			continue
+		}
+
+		if want, got := tt.op, p.Operation; want != got {
+			t.Fatalf("[%02d] test %q, unexpected operation: %v != %v",
+				i, tt.desc, want, got)
+		}
+		if want, got := uint16(HardwareTypeEthernet), p.HardwareType; want != got {
+			t.Fatalf("[%02d] test %q, unexpected hardware type: %v != %v",
+				i, tt.desc, want, got)
+		}
+		if want, got := uint16(ethernet.EtherTypeIPv4), p.ProtocolType; want != got {
+			t.Fatalf("[%02d] test %q, unexpected protocol type: %v != %v",
+				i, tt.desc, want, got)
+		}
+	}
+}
+
+func TestPacketIPv4Normalized(t *testing.T) {
+	mac := net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+
+	want, err := NewPacket(OperationRequest, mac, net.IPv4(192, 168, 1, 10), ethernet.Broadcast, net.IPv4(192, 168, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A Packet built by hand may carry 16-byte IPv4 addresses, which must
+	// still be encoded as their 4-byte form
+	lit := *want
+	lit.SenderIP = net.IPv4(192, 168, 1, 10)
+	lit.TargetIP = net.IPv4(192, 168, 1, 1)
+
+	b, err := lit.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := new(Packet)
+	if err := got.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ip := range []net.IP{got.SenderIP, got.TargetIP} {
+		if want, got := net.IPv4len, len(ip); want != got {
+			t.Fatalf("unexpected IPv4 address length: %v != %v", want, got)
+		}
+	}
+
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("decoded packet does not match constructed packet:\n- want: %v\n-  got: %v",
+			want, got)
+	}
+}
+
+func TestPacketUnmarshalBinaryN(t *testing.T) {
+	p1, err := NewPacket(
+		OperationRequest,
+		net.HardwareAddr{0xad, 0xbe, 0xef, 0xde, 0xad, 0xde},
+		net.IPv4(192, 168, 1, 10),
+		net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+		net.IPv4(192, 168, 1, 1),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p2, err := NewPacket(
+		OperationReply,
+		net.HardwareAddr{0, 1, 2, 3, 4, 5, 6, 7},
+		net.IPv4(10, 0, 0, 1),
+		net.HardwareAddr{8, 9, 10, 11, 12, 13, 14, 15},
+		net.IPv4(10, 0, 0, 2),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b []byte
+	for _, p := range []*Packet{p1, p2} {
+		pb, err := p.MarshalBinary()
 		if err != nil {
 			t.Fatal(err)
 		}
 
-		if want, got := tt.b, b; !bytes.Equal(want, got) {
-			t.Fatalf("[%02d] test %q, unexpected Packet bytes:\n- want: %v\n- got: %v",
-				i, tt.desc, want, got)
+		b = append(b, pb...)
+	}
+
+	var got []*Packet
+	for off := 0; off < len(b); {
+		p := new(Packet)
+		n, err := p.UnmarshalBinaryN(b[off:])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want, got := p.Len(), n; want != got {
+			t.Fatalf("unexpected number of bytes consumed: %v != %v", want, got)
 		}
+
+		got = append(got, p)
+		off += n
+	}
+
+	if want := []*Packet{p1, p2}; !reflect.DeepEqual(want, got) {
+		t.Fatalf("unexpected packets:\n- want: %v\n-  got: %v", want, got)
+	}
+
+	// A truncated packet consumes no bytes
+	n, err := new(Packet).UnmarshalBinaryN(b[:p1.Len()-1])
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("unexpected error for truncated packet: %v", err)
+	}
+	if want, got := 0, n; want != got {
+		t.Fatalf("unexpected number of bytes consumed: %v != %v", want, got)
+	}
+}
+
+func TestPacketLenBounds(t *testing.T) {
+	p, err := NewPacket(
+		OperationRequest,
+		net.HardwareAddr{0xad, 0xbe, 0xef, 0xde, 0xad, 0xde},
+		net.IP{192, 168, 1, 10},
+		net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+		net.IP{192, 168, 1, 1},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := MinPacketLen, p.Len(); want != got {
+		t.Fatalf("unexpected length for IPv4 over ethernet: %v != %v", want, got)
+	}
+
+	max := &Packet{
+		MACLength: 255,
+		IPLength:  255,
+	}
+	if want, got := MaxPacketLen, max.Len(); want != got {
+		t.Fatalf("unexpected length for maximum address lengths: %v != %v", want, got)
+	}
+
+	// The default read buffer must hold the largest packet in an ethernet
+	// frame with two VLAN tags
+	if want, got := 14+(2*4)+MaxPacketLen, DefaultReadBufferSize; want > got {
+		t.Fatalf("default read buffer too small: %v > %v", want, got)
 	}
 }
 
@@ -248,7 +1358,7 @@ func TestPacketUnmarshalBinary(t *testing.T) {
 			b: []byte{
 				0, 1,
 				8, 0,
-				255,
+				20,
 				4,
 				0, 1,
 			},
@@ -260,11 +1370,33 @@ func TestPacketUnmarshalBinary(t *testing.T) {
 				0, 1,
 				8, 0,
 				6,
-				255,
+				16,
 				0, 1,
 			},
 			err: io.ErrUnexpectedEOF,
 		},
+		{
+			desc: "MAC address length too long",
+			b: []byte{
+				0, 1,
+				8, 0,
+				21,
+				4,
+				0, 1,
+			},
+			err: ErrAddressTooLong,
+		},
+		{
+			desc: "IP address length too long",
+			b: []byte{
+				0, 1,
+				8, 0,
+				6,
+				17,
+				0, 1,
+			},
+			err: ErrAddressTooLong,
+		},
 		{
 			desc: "ARP request to ethernet broadcast, 6 byte MAC addresses",
 			b: []byte{
@@ -322,7 +1454,7 @@ func TestPacketUnmarshalBinary(t *testing.T) {
 	for i, tt := range tests {
 		p := new(Packet)
 		if err := p.UnmarshalBinary(tt.b); err != nil {
-			if want, got := tt.err, err; want != got {
+			if want, got := tt.err, err; !errors.Is(got, want) {
 				t.Fatalf("[%02d] test %q, unexpected error: %v != %v",
 					i, tt.desc, want, got)
 			}
@@ -352,6 +1484,16 @@ func Test_parsePacket(t *testing.T) {
 			buf:  make([]byte, 56),
 			err:  errInvalidARPPacket,
 		},
+		{
+			desc: "ARP EtherType with 5 byte payload",
+			buf: []byte{
+				0, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0, 0,
+				0x08, 0x06,
+				0, 1, 0x08, 0x00, 6,
+			},
+			err: ErrTruncatedARP,
+		},
 		{
 			desc: "invalid ARP packet",
 			buf: append([]byte{
@@ -360,7 +1502,7 @@ func Test_parsePacket(t *testing.T) {
 				0x08, 0x06,
 				0, 0,
 				0, 0,
-				255, 255,
+				20, 16,
 			}, make([]byte, 40)...),
 			err: io.ErrUnexpectedEOF,
 		},
@@ -396,7 +1538,97 @@ func Test_parsePacket(t *testing.T) {
 	for i, tt := range tests {
 		p, _, err := parsePacket(tt.buf)
 		if err != nil {
-			if want, got := tt.err, err; want != got {
+			if want, got := tt.err, err; !errors.Is(got, want) {
+				t.Fatalf("[%02d] test %q, unexpected error: %v != %v",
+					i, tt.desc, want, got)
+			}
+
+			continue
+		}
+
+		if want, got := tt.p, p; !reflect.DeepEqual(want, got) {
+			t.Fatalf("[%02d] test %q, unexpected Packet:\n- want: %v\n- got: %v",
+				i, tt.desc, want, got)
+		}
+	}
+}
+
+func TestParsePacket(t *testing.T) {
+	ok := append([]byte{
+		0xed, 0xad, 0xbe, 0xef, 0xde, 0xad,
+		0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff,
+		0x08, 0x06,
+		0, 1,
+		0x08, 0x06,
+		6, 4,
+		0, 2,
+		0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff,
+		192, 168, 1, 10,
+		0xed, 0xad, 0xbe, 0xef, 0xde, 0xad,
+		192, 168, 1, 1,
+	}, make([]byte, 40)...)
+
+	var tests = []struct {
+		desc   string
+		buf    []byte
+		p      *Packet
+		err    error
+		notARP bool
+	}{
+		{
+			desc: "invalid ethernet frame",
+			err:  io.ErrUnexpectedEOF,
+		},
+		{
+			desc:   "non-ARP EtherType",
+			buf:    make([]byte, 56),
+			notARP: true,
+		},
+		{
+			desc: "ARP EtherType with 5 byte payload",
+			buf: []byte{
+				0, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0, 0,
+				0x08, 0x06,
+				0, 1, 0x08, 0x00, 6,
+			},
+			err: ErrTruncatedARP,
+		},
+		{
+			desc: "OK",
+			buf:  ok,
+			p: &Packet{
+				HardwareType: 1,
+				ProtocolType: 2054,
+				MACLength:    6,
+				IPLength:     4,
+				Operation:    OperationReply,
+				SenderMAC:    net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff},
+				SenderIP:     net.IP{192, 168, 1, 10},
+				TargetMAC:    net.HardwareAddr{0xed, 0xad, 0xbe, 0xef, 0xde, 0xad},
+				TargetIP:     net.IP{192, 168, 1, 1},
+			},
+		},
+	}
+
+	for i, tt := range tests {
+		p, f, err := ParsePacket(tt.buf)
+		if tt.notARP {
+			var nerr *NotARPError
+			if !errors.As(err, &nerr) {
+				t.Fatalf("[%02d] test %q, expected *NotARPError, got: %v",
+					i, tt.desc, err)
+			}
+			if f == nil || nerr.Frame != f {
+				t.Fatalf("[%02d] test %q, frame was not returned with error",
+					i, tt.desc)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			if want, got := tt.err, err; !errors.Is(got, want) {
 				t.Fatalf("[%02d] test %q, unexpected error: %v != %v",
 					i, tt.desc, want, got)
 			}
@@ -411,6 +1643,113 @@ func Test_parsePacket(t *testing.T) {
 	}
 }
 
+func Test_parsePacketVLAN(t *testing.T) {
+	buf := append([]byte{
+		0xde, 0xad, 0xbe, 0xef, 0xde, 0xad,
+		0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff,
+		0x81, 0x00,
+		0x00, 0x0a,
+		0x08, 0x06,
+		0, 1,
+		0x08, 0x00,
+		6, 4,
+		0, 2,
+		0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff,
+		192, 168, 1, 10,
+		0xde, 0xad, 0xbe, 0xef, 0xde, 0xad,
+		192, 168, 1, 1,
+	}, make([]byte, 40)...)
+
+	p, f, err := parsePacket(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := OperationReply, p.Operation; want != got {
+		t.Fatalf("unexpected operation: %v != %v", want, got)
+	}
+	if want, got := 1, len(f.VLAN); want != got {
+		t.Fatalf("unexpected number of VLAN tags: %v != %v", want, got)
+	}
+	if want, got := uint16(10), f.VLAN[0].ID; want != got {
+		t.Fatalf("unexpected VLAN ID: %v != %v", want, got)
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	var tests = []struct {
+		desc   string
+		b      []byte
+		frame  bool
+		offset int
+		err    error
+	}{
+		{
+			desc:   "short header",
+			b:      []byte{0, 1, 8, 0},
+			offset: 0,
+			err:    io.ErrUnexpectedEOF,
+		},
+		{
+			desc:   "address length too long",
+			b:      []byte{0, 1, 8, 0, 255, 4, 0, 1},
+			offset: 4,
+			err:    ErrAddressTooLong,
+		},
+		{
+			desc:   "short addresses",
+			b:      []byte{0, 1, 8, 0, 6, 4, 0, 1, 0, 0},
+			offset: 8,
+			err:    io.ErrUnexpectedEOF,
+		},
+		{
+			desc:   "short addresses in frame",
+			frame:  true,
+			b:      []byte{0, 1, 8, 0, 6, 4, 0, 1, 0, 0},
+			offset: 14 + 8,
+			err:    io.ErrUnexpectedEOF,
+		},
+		{
+			desc:   "short header in frame",
+			frame:  true,
+			b:      []byte{0, 1, 8, 0, 6},
+			offset: 14,
+			err:    ErrTruncatedARP,
+		},
+	}
+
+	for i, tt := range tests {
+		var err error
+		if tt.frame {
+			buf := append([]byte{
+				0, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0, 0,
+				0x08, 0x06,
+			}, tt.b...)
+			_, _, err = parsePacket(buf)
+		} else {
+			err = new(Packet).UnmarshalBinary(tt.b)
+		}
+
+		derr, ok := err.(*DecodeError)
+		if !ok {
+			t.Fatalf("[%02d] test %q, unexpected error type: %T", i, tt.desc, err)
+		}
+
+		if want, got := tt.offset, derr.Offset; want != got {
+			t.Fatalf("[%02d] test %q, unexpected offset: %v != %v",
+				i, tt.desc, want, got)
+		}
+		if !errors.Is(err, tt.err) {
+			t.Fatalf("[%02d] test %q, unexpected underlying error: %v",
+				i, tt.desc, err)
+		}
+		if derr.Snippet == "" {
+			t.Fatalf("[%02d] test %q, missing snippet", i, tt.desc)
+		}
+	}
+}
+
 // Benchmarks for Packet.MarshalBinary
 
 func BenchmarkPacketMarshalBinary(b *testing.B) {
@@ -438,6 +1777,29 @@ func benchmarkPacketMarshalBinary(b *testing.B, p *Packet) {
 	}
 }
 
+func BenchmarkPacketMarshalBinaryTo(b *testing.B) {
+	p, err := NewPacket(
+		OperationRequest,
+		net.HardwareAddr{0xad, 0xbe, 0xef, 0xde, 0xad, 0xde},
+		net.IP{192, 168, 1, 10},
+		net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+		net.IP{192, 168, 1, 1},
+	)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	var buf [64]byte
+
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.MarshalBinaryTo(buf[:]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 // Benchmarks for Packet.UnmarshalBinary
 
 func BenchmarkPacketUnmarshalBinary(b *testing.B) {
@@ -0,0 +1,26 @@
+package arp
+
+import (
+	"errors"
+)
+
+// ErrPromiscuousUnsupported is returned by SetPromiscuous on platforms
+// where promiscuous mode cannot be configured.
+var ErrPromiscuousUnsupported = errors.New("promiscuous mode is not supported on this platform")
+
+// SetPromiscuous enables or disables promiscuous mode on the Client's
+// network interface. In promiscuous mode, the interface delivers all frames
+// it receives, rather than only those addressed to it, which is useful for
+// passively monitoring ARP traffic on a mirror port.
+//
+// Promiscuous mode is a property of the network interface, not the Client's
+// socket: it affects all other users of the interface, and it is not
+// disabled when the Client is closed. Callers which enable promiscuous mode
+// are responsible for disabling it again.
+//
+// SetPromiscuous is currently only supported on Linux, where it requires
+// the CAP_NET_ADMIN capability. On other platforms,
+// ErrPromiscuousUnsupported is returned.
+func (c *Client) SetPromiscuous(enable bool) error {
+	return setPromiscuous(c.ifi.Name, enable)
+}
@@ -0,0 +1,52 @@
+// +build linux
+
+package arp
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// ifreqFlags is the subset of the Linux ifreq structure used to get and set
+// network interface flags
+type ifreqFlags struct {
+	Name  [syscall.IFNAMSIZ]byte
+	Flags uint16
+	_     [22]byte
+}
+
+// setPromiscuous sets or clears the IFF_PROMISC flag on the named network
+// interface
+func setPromiscuous(name string, enable bool) error {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM, 0)
+	if err != nil {
+		return os.NewSyscallError("socket", err)
+	}
+	defer syscall.Close(fd)
+
+	var ifr ifreqFlags
+	copy(ifr.Name[:len(ifr.Name)-1], name)
+
+	if err := ioctlIfreq(fd, syscall.SIOCGIFFLAGS, &ifr); err != nil {
+		return err
+	}
+
+	if enable {
+		ifr.Flags |= syscall.IFF_PROMISC
+	} else {
+		ifr.Flags &^= syscall.IFF_PROMISC
+	}
+
+	return ioctlIfreq(fd, syscall.SIOCSIFFLAGS, &ifr)
+}
+
+// ioctlIfreq performs the ioctl req on fd using ifr
+func ioctlIfreq(fd int, req uintptr, ifr *ifreqFlags) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), req, uintptr(unsafe.Pointer(ifr)))
+	if errno != 0 {
+		return os.NewSyscallError("ioctl", errno)
+	}
+
+	return nil
+}
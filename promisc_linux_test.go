@@ -0,0 +1,66 @@
+// +build linux,privileged
+
+package arp
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+// TestClientSetPromiscuous requires the CAP_NET_ADMIN capability, and a
+// network interface named by the ARP_TEST_INTERFACE environment variable.
+// Run it using:
+//
+//	ARP_TEST_INTERFACE=eth0 go test -tags privileged -run SetPromiscuous
+func TestClientSetPromiscuous(t *testing.T) {
+	name := os.Getenv("ARP_TEST_INTERFACE")
+	if name == "" {
+		t.Skip("ARP_TEST_INTERFACE not set")
+	}
+
+	ifi, err := net.InterfaceByName(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Client{ifi: ifi}
+
+	if err := c.SetPromiscuous(true); err != nil {
+		t.Fatal(err)
+	}
+	defer c.SetPromiscuous(false)
+
+	if !interfacePromiscuous(t, name) {
+		t.Fatal("promiscuous mode was not enabled")
+	}
+
+	if err := c.SetPromiscuous(false); err != nil {
+		t.Fatal(err)
+	}
+
+	if interfacePromiscuous(t, name) {
+		t.Fatal("promiscuous mode was not disabled")
+	}
+}
+
+// interfacePromiscuous reports whether the named interface is in
+// promiscuous mode
+func interfacePromiscuous(t *testing.T, name string) bool {
+	t.Helper()
+
+	b, err := ioutil.ReadFile("/sys/class/net/" + name + "/flags")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var flags uint32
+	if _, err := fmt.Sscanf(string(b), "0x%x", &flags); err != nil {
+		t.Fatal(err)
+	}
+
+	return flags&syscall.IFF_PROMISC != 0
+}
@@ -0,0 +1,8 @@
+// +build !linux
+
+package arp
+
+// setPromiscuous is not supported on this platform
+func setPromiscuous(name string, enable bool) error {
+	return ErrPromiscuousUnsupported
+}
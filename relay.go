@@ -0,0 +1,97 @@
+package arp
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sync"
+
+	"github.com/caser789/ethernet"
+)
+
+// A Relay forwards ARP packets between two network segments, such as for a
+// software bridge. A Relay reads ARP packets using its input Client, and
+// writes them unchanged using its output Client, addressed to the same
+// ethernet destination.
+//
+// To avoid forwarding loops, a Relay learns which segment each hardware
+// address was seen on, and never forwards a packet back to the segment it
+// came from. Packets sent from the hardware address of the output Client's
+// network interface are also never forwarded. To relay in both directions,
+// run both a Relay and the Relay returned by its Reverse method, so that
+// both directions share what they have learned. Learned addresses do not
+// expire.
+//
+// While a Relay is running, it owns the read side of its input Client, and
+// the Client's Read and Resolve methods must not be used.
+type Relay struct {
+	in, out *Client
+
+	// side identifies the segment of the input Client in the shared table
+	side  int
+	table *relayTable
+}
+
+// relayTable records the segment on which each hardware address was seen
+type relayTable struct {
+	mu    sync.Mutex
+	sides map[string]int
+}
+
+// NewRelay creates a new Relay which forwards ARP packets read by in to
+// out.
+func NewRelay(in, out *Client) *Relay {
+	return &Relay{
+		in:  in,
+		out: out,
+		table: &relayTable{
+			sides: make(map[string]int),
+		},
+	}
+}
+
+// Reverse returns a Relay which forwards ARP packets in the opposite
+// direction, from r's output Client to its input Client, and which shares
+// the hardware addresses learned by r.
+func (r *Relay) Reverse() *Relay {
+	return &Relay{
+		in:    r.out,
+		out:   r.in,
+		side:  1 - r.side,
+		table: r.table,
+	}
+}
+
+// Run reads and forwards ARP packets until ctx is canceled or an error
+// occurs while reading or writing. If ctx is canceled, Run returns nil,
+// and the input Client may be read from again once Run has returned.
+func (r *Relay) Run(ctx context.Context) error {
+	return readUntil(ctx, r.in, func(p *Packet, f *ethernet.Frame) error {
+		if !r.learn(f.Source) {
+			return nil
+		}
+
+		return r.out.WriteTo(p, f.Destination)
+	})
+}
+
+// learn records that mac was seen on the input Client's segment, and
+// reports whether a packet from mac should be forwarded
+func (r *Relay) learn(mac net.HardwareAddr) bool {
+	if bytes.Equal(mac, r.out.ifi.HardwareAddr) {
+		return false
+	}
+
+	r.table.mu.Lock()
+	defer r.table.mu.Unlock()
+
+	key := string(mac)
+	if side, ok := r.table.sides[key]; ok && side != r.side {
+		// mac is on the output segment, so this packet was relayed to
+		// the input segment, possibly by another bridge
+		return false
+	}
+
+	r.table.sides[key] = r.side
+	return true
+}
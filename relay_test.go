@@ -0,0 +1,137 @@
+package arp
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/caser789/arp/arptest"
+)
+
+func TestRelayResolve(t *testing.T) {
+	hostAMAC := net.HardwareAddr{0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0x01}
+	relayAMAC := net.HardwareAddr{0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0x02}
+	relayBMAC := net.HardwareAddr{0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0x01}
+	hostBMAC := net.HardwareAddr{0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0x02}
+
+	// Two segments, each connecting a host to one side of the relay
+	pa, pra := arptest.Pipe(hostAMAC, relayAMAC)
+	prb, pb := arptest.Pipe(relayBMAC, hostBMAC)
+
+	hostA := newRelayTestClient(t, hostAMAC, net.IPv4(192, 168, 1, 1), pa)
+	relayA := newRelayTestClient(t, relayAMAC, net.IPv4(192, 168, 1, 253), pra)
+	relayB := newRelayTestClient(t, relayBMAC, net.IPv4(192, 168, 1, 254), prb)
+	hostB := newRelayTestClient(t, hostBMAC, net.IPv4(192, 168, 1, 2), pb)
+	for _, c := range []*Client{hostA, relayA, relayB, hostB} {
+		defer c.Close()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	r := NewRelay(relayA, relayB)
+	errC := make(chan error, 2)
+	for _, rr := range []*Relay{r, r.Reverse()} {
+		go func(rr *Relay) {
+			errC <- rr.Run(ctx)
+		}(rr)
+	}
+
+	go func() {
+		_ = hostB.Respond(hostB.ip)
+	}()
+
+	mac, err := hostA.ResolveTimeout(hostB.ip, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := hostBMAC, mac; !bytes.Equal(want, got) {
+		t.Fatalf("unexpected resolved MAC: %v != %v", want, got)
+	}
+
+	cancel()
+	for i := 0; i < 2; i++ {
+		if err := <-errC; err != nil {
+			t.Fatalf("unexpected relay error: %v", err)
+		}
+	}
+}
+
+func TestRelayLearn(t *testing.T) {
+	inMAC := net.HardwareAddr{0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0x02}
+	outMAC := net.HardwareAddr{0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0x01}
+	hostA := net.HardwareAddr{0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0x01}
+	hostB := net.HardwareAddr{0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0x02}
+
+	r := NewRelay(
+		&Client{ifi: &net.Interface{HardwareAddr: inMAC}},
+		&Client{ifi: &net.Interface{HardwareAddr: outMAC}},
+	)
+	rev := r.Reverse()
+
+	var tests = []struct {
+		desc string
+		r    *Relay
+		mac  net.HardwareAddr
+		ok   bool
+	}{
+		{desc: "output interface", r: r, mac: outMAC},
+		{desc: "reverse output interface", r: rev, mac: inMAC},
+		{desc: "host A first seen", r: r, mac: hostA, ok: true},
+		{desc: "host A seen again", r: r, mac: hostA, ok: true},
+		{desc: "host B first seen", r: rev, mac: hostB, ok: true},
+		{desc: "host B relayed back", r: r, mac: hostB},
+		{desc: "host A relayed back", r: rev, mac: hostA},
+	}
+
+	for i, tt := range tests {
+		if want, got := tt.ok, tt.r.learn(tt.mac); want != got {
+			t.Fatalf("[%02d] test %q, unexpected forward result: %v != %v",
+				i, tt.desc, want, got)
+		}
+	}
+}
+
+func TestRelayRunCanceledClearsDeadline(t *testing.T) {
+	p := newChanReadFromPacketConn()
+	in := &Client{
+		ifi: &net.Interface{HardwareAddr: net.HardwareAddr{0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0x02}},
+		p:   p,
+	}
+	out := &Client{
+		ifi: &net.Interface{HardwareAddr: net.HardwareAddr{0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0x01}},
+		p:   &noopPacketConn{},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errC := make(chan error, 1)
+	go func() {
+		errC <- NewRelay(in, out).Run(ctx)
+	}()
+
+	cancel()
+	if err := <-errC; err != nil {
+		t.Fatalf("unexpected relay error: %v", err)
+	}
+
+	testClientReadsAfterStop(t, in, p)
+}
+
+// newRelayTestClient creates a Client on a /24 subnet which uses p
+func newRelayTestClient(t *testing.T, mac net.HardwareAddr, ip net.IP, p net.PacketConn) *Client {
+	t.Helper()
+
+	c, err := newClient(&net.Interface{
+		HardwareAddr: mac,
+	}, p, []net.Addr{&net.IPNet{
+		IP:   ip,
+		Mask: net.CIDRMask(24, 32),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
@@ -0,0 +1,84 @@
+package arp
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultReplyThrottleWindow is the default amount of time during which a
+// ReplyThrottle suppresses repeated replies to the same requester
+const DefaultReplyThrottleWindow = 1 * time.Second
+
+// A ReplyThrottle suppresses repeated replies to the same request, such as
+// when a proxy ARP responder receives rapid retransmits from a requester,
+// or shares a segment with another proxy which forwards its replies.
+// Requests are considered the same if they have the same target IPv4
+// address and sender hardware address.
+//
+// The zero value of ReplyThrottle is ready for use, and a ReplyThrottle is
+// safe for concurrent use.
+type ReplyThrottle struct {
+	// Window specifies how long after allowing a reply to a request the
+	// same request is suppressed. If zero, DefaultReplyThrottleWindow is
+	// used.
+	Window time.Duration
+
+	mu     sync.Mutex
+	last   map[replyKey]time.Time
+	pruned time.Time
+
+	// now is used to retrieve the current time, so tests can control
+	// expiration. If nil, time.Now is used
+	now func() time.Time
+}
+
+// replyKey identifies a request for the purposes of throttling
+type replyKey struct {
+	targetIP  string
+	senderMAC string
+}
+
+// Allow reports whether a reply to req should be sent. Allow returns true
+// for the first occurrence of a request, and false for the same request
+// until Window has elapsed.
+func (t *ReplyThrottle) Allow(req *Packet) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	if t.now != nil {
+		now = t.now()
+	}
+
+	window := t.Window
+	if window == 0 {
+		window = DefaultReplyThrottleWindow
+	}
+
+	if t.last == nil {
+		t.last = make(map[replyKey]time.Time)
+	}
+
+	// Periodically discard expired entries, so requests which are never
+	// repeated do not accumulate
+	if now.Sub(t.pruned) >= window {
+		for k, seen := range t.last {
+			if now.Sub(seen) >= window {
+				delete(t.last, k)
+			}
+		}
+		t.pruned = now
+	}
+
+	key := replyKey{
+		targetIP:  req.TargetIP.String(),
+		senderMAC: req.SenderMAC.String(),
+	}
+
+	if seen, ok := t.last[key]; ok && now.Sub(seen) < window {
+		return false
+	}
+
+	t.last[key] = now
+	return true
+}
@@ -0,0 +1,66 @@
+package arp
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestReplyThrottleAllow(t *testing.T) {
+	now := time.Now()
+	rt := &ReplyThrottle{
+		Window: time.Second,
+		now:    func() time.Time { return now },
+	}
+
+	req := &Packet{
+		Operation: OperationRequest,
+		SenderMAC: net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff},
+		SenderIP:  net.IPv4(192, 168, 1, 10),
+		TargetIP:  net.IPv4(192, 168, 1, 1),
+	}
+	other := &Packet{
+		Operation: OperationRequest,
+		SenderMAC: net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x00},
+		SenderIP:  net.IPv4(192, 168, 1, 11),
+		TargetIP:  net.IPv4(192, 168, 1, 1),
+	}
+
+	var tests = []struct {
+		desc    string
+		advance time.Duration
+		p       *Packet
+		allow   bool
+	}{
+		{
+			desc:  "first request",
+			p:     req,
+			allow: true,
+		},
+		{
+			desc:    "repeated request within window",
+			advance: 100 * time.Millisecond,
+			p:       req,
+		},
+		{
+			desc:  "request from another sender",
+			p:     other,
+			allow: true,
+		},
+		{
+			desc:    "repeated request after window",
+			advance: time.Second,
+			p:       req,
+			allow:   true,
+		},
+	}
+
+	for i, tt := range tests {
+		now = now.Add(tt.advance)
+
+		if want, got := tt.allow, rt.Allow(tt.p); want != got {
+			t.Fatalf("[%02d] test %q, unexpected result: %v != %v",
+				i, tt.desc, want, got)
+		}
+	}
+}